@@ -0,0 +1,395 @@
+package board
+
+import (
+    "crypto/sha1"
+    "embed"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "hash/crc32"
+    "io"
+    "io/ioutil"
+    "os"
+    "path"
+    "path/filepath"
+    "sort"
+    "strconv"
+    "strings"
+
+    "github.com/bartgrantham/fpemu/cpu/m6800"
+    "github.com/bartgrantham/fpemu/mem/d8224"
+)
+
+/*
+
+A sound board, what's on it and where, read from JSON:
+
+    {
+        "name"   : "defender",
+        "cpu"    : "m6802",
+        "clock"  : "3579545/4",
+        "rom"    : [ {"addr":"F800", "file":"defend.snd", "crc32":"0123abcd"} ],
+        "ram"    : [ {"addr":"EFFD", "size":1} ],
+        "devices": [ {"type":"m6821", "addr":"0400", "mask":"7FFF"},
+                     {"type":"latch", "addr":"2000", "size":4} ],
+        "input"  : {"port":"B", "invert":true}
+    }
+
+Addresses are hex strings ("F800", "$F800" or "0xF800") or plain numbers.
+Each ROM, RAM and device can have a "mask" of the address lines the board
+decodes for it, it then shows up at every address that matches on those
+lines (see d8224.Region), the default is a full decode and no mirrors.  The
+addr is where it's listed and traced, so for ROM it should be where the code
+runs, usually the mirror with the vectors.  ROM files are relative to the
+board file, checksums are optional and checked when given.  cpu and clock
+default to the 6802 and the pinball clock, the sound PIA to $0400, and input
+to the sound command on port B, inverted, the way the mainboard drives it.
+See device_sizes for the devices.
+
+*/
+
+type Board struct {
+    Name     string    `json:"name"`
+    CPU      string    `json:"cpu,omitempty"`
+    Clock    string    `json:"clock,omitempty"`
+    ROM      []ROM     `json:"rom"`
+    RAM      []RAM     `json:"ram,omitempty"`
+    Devices  []Device  `json:"devices,omitempty"`
+    Input    *Input    `json:"input,omitempty"`
+    dir      string    // ROM files are relative to this
+}
+
+type ROM struct {
+    Addr   Addr    `json:"addr"`
+    Mask   Addr    `json:"mask,omitempty"`
+    File   string  `json:"file"`
+    CRC32  string  `json:"crc32,omitempty"`
+    SHA1   string  `json:"sha1,omitempty"`
+}
+
+type RAM struct {
+    Addr  Addr    `json:"addr"`
+    Mask  Addr    `json:"mask,omitempty"`
+    Size  uint32  `json:"size,omitempty"`  // bytes, 1 if not given
+}
+
+type Device struct {
+    Type  string  `json:"type"`
+    Addr  Addr    `json:"addr"`
+    Mask  Addr    `json:"mask,omitempty"`
+    Size  uint32  `json:"size,omitempty"`  // registers, the type's own count if not given
+}
+
+// the devices a board can have and how many registers each takes
+//     m6821  the PIA, the first one is the sound PIA with the DAC and the
+//            command input, the rest just have their IRQs wired to the CPU
+//     latch  registers that read back what was written, for anything that
+//            isn't emulated
+var device_sizes = map[string]uint32{
+    "m6821": 4,
+    "latch": 1,
+}
+
+// where the sound command from the keyboard goes
+type Input struct {
+    Port    string  `json:"port"`    // "A" or "B"
+    Invert  bool    `json:"invert"`  // the mainboard drives the lines active low
+}
+
+var default_input = Input{"B", true}
+
+type Addr uint16
+
+func (a *Addr) UnmarshalJSON(data []byte) error {
+    var text string
+    if err := json.Unmarshal(data, &text); err != nil {
+        var n uint16
+        if err := json.Unmarshal(data, &n); err != nil {
+            return fmt.Errorf("invalid address %s", data)
+        }
+        *a = Addr(n)
+        return nil
+    }
+    n, err := parse_addr(text)
+    if err != nil {
+        return err
+    }
+    *a = Addr(n)
+    return nil
+}
+
+func (a Addr) MarshalJSON() ([]byte, error) {
+    return json.Marshal(fmt.Sprintf("%.4X", uint16(a)))
+}
+
+// "F800", "$F800" or "0xF800"
+func parse_addr(text string) (uint16, error) {
+    hex := strings.TrimPrefix(text, "$")
+    if strings.HasPrefix(hex, "0x") || strings.HasPrefix(hex, "0X") {
+        hex = hex[2:]
+    }
+    n, err := strconv.ParseUint(hex, 16, 16)
+    if err != nil {
+        return 0, fmt.Errorf("invalid address %q", text)
+    }
+    return uint16(n), nil
+}
+
+//go:embed builtin/*.json
+var builtin embed.FS
+
+// The boards that ship with fpemu, by name
+func Names() []string {
+    entries, _ := builtin.ReadDir("builtin")
+    var names []string
+    for _, entry := range entries {
+        names = append(names, strings.TrimSuffix(entry.Name(), ".json"))
+    }
+    sort.Strings(names)
+    return names
+}
+
+// A built-in board, its ROM files are relative to the current directory
+func Builtin(name string) (*Board, bool) {
+    fh, err := builtin.Open(path.Join("builtin", name + ".json"))
+    if err != nil {
+        return nil, false
+    }
+    defer fh.Close()
+    b, err := Parse(fh, ".")
+    if err != nil {
+        // they're checked by the tests
+        panic(fmt.Sprintf("built-in board %s: %v", name, err))
+    }
+    return b, true
+}
+
+func Load(filename string) (*Board, error) {
+    fh, err := os.Open(filename)
+    if err != nil {
+        return nil, err
+    }
+    defer fh.Close()
+    b, err := Parse(fh, filepath.Dir(filename))
+    if err != nil {
+        return nil, fmt.Errorf("%s: %v", filename, err)
+    }
+    return b, nil
+}
+
+// Read a board, dir is where its ROM files are
+func Parse(r io.Reader, dir string) (*Board, error) {
+    dec := json.NewDecoder(r)
+    dec.DisallowUnknownFields()
+    b := &Board{}
+    if err := dec.Decode(b); err != nil {
+        return nil, err
+    }
+    b.dir = dir
+    if err := b.check(); err != nil {
+        return nil, err
+    }
+    return b, nil
+}
+
+// The board the old command line describes: "addr=file", "RAM=addr,addr-addr",
+// "CPU=variant" and "CLOCK=hz/divider", ROM files relative to the current
+// directory
+func FromSpecs(name string, specs []string) (*Board, error) {
+    b := &Board{Name:name, dir:"."}
+    for _, spec := range specs {
+        parts := strings.SplitN(spec, "=", 2)
+        if len(parts) < 2 {
+            return nil, fmt.Errorf("invalid argument %s", spec)
+        }
+        switch strings.ToUpper(parts[0]) {
+            case "CPU":
+                b.CPU = parts[1]
+            case "CLOCK":
+                b.Clock = parts[1]
+            case "RAM":
+                for _, span := range strings.Split(parts[1], ",") {
+                    startend := strings.Split(span, "-")
+                    start, err := parse_addr(startend[0])
+                    if err != nil {
+                        return nil, err
+                    }
+                    end := uint32(start) + 1
+                    if len(startend) > 1 {
+                        tmp, err := parse_addr(startend[1])
+                        if err != nil {
+                            return nil, err
+                        }
+                        end = uint32(tmp)
+                    }
+                    if end <= uint32(start) {
+                        return nil, fmt.Errorf("invalid RAM %s", span)
+                    }
+                    b.RAM = append(b.RAM, RAM{Addr:Addr(start), Size:end - uint32(start)})
+                }
+            default:
+                addr, err := parse_addr(parts[0])
+                if err != nil {
+                    return nil, err
+                }
+                b.ROM = append(b.ROM, ROM{Addr:Addr(addr), File:parts[1]})
+        }
+    }
+    if err := b.check(); err != nil {
+        return nil, err
+    }
+    return b, nil
+}
+
+// everything that can be checked without reading the ROMs
+func (b *Board) check() error {
+    if len(b.ROM) == 0 {
+        return fmt.Errorf("no ROMs")
+    }
+    if _, err := b.Variant(); err != nil {
+        return err
+    }
+    if _, err := b.CPUClock(); err != nil {
+        return err
+    }
+    for _, rom := range b.ROM {
+        if rom.File == "" {
+            return fmt.Errorf("ROM at $%.4X has no file", uint16(rom.Addr))
+        }
+        if rom.Addr < 128 {
+            return fmt.Errorf("ROM at $%.4X is over the internal RAM", uint16(rom.Addr))
+        }
+        if _, err := hex.DecodeString(rom.CRC32); err != nil || (rom.CRC32 != "" && len(rom.CRC32) != 8) {
+            return fmt.Errorf("%s: invalid crc32 %q", rom.File, rom.CRC32)
+        }
+        if _, err := hex.DecodeString(rom.SHA1); err != nil || (rom.SHA1 != "" && len(rom.SHA1) != 40) {
+            return fmt.Errorf("%s: invalid sha1 %q", rom.File, rom.SHA1)
+        }
+    }
+    for _, ram := range b.RAM {
+        if ram.Addr < 128 || uint32(ram.Addr) + ram.size() > 1<<16 {
+            return fmt.Errorf("invalid RAM at $%.4X, %d bytes", uint16(ram.Addr), ram.size())
+        }
+    }
+    for _, dev := range b.Devices {
+        size, ok := device_sizes[dev.Type]
+        if !ok {
+            return fmt.Errorf("unknown device %q", dev.Type)
+        }
+        if dev.Size != 0 && dev.Type == "m6821" && dev.Size != size {
+            return fmt.Errorf("an m6821 has %d registers", size)
+        }
+        if dev.Addr < 128 || uint32(dev.Addr) + dev.size() > 1<<16 {
+            return fmt.Errorf("invalid %s at $%.4X, %d registers", dev.Type, uint16(dev.Addr), dev.size())
+        }
+    }
+    if in := b.Input; in != nil && in.Port != "A" && in.Port != "B" {
+        return fmt.Errorf("invalid input port %q, A or B", in.Port)
+    }
+    return nil
+}
+
+func region(addr Addr, size int, mask Addr) d8224.Region {
+    if mask == 0 {
+        return d8224.Span(uint16(addr), size)
+    }
+    return d8224.Region{Base:uint16(addr), Size:size, Mask:uint16(mask)}
+}
+
+// Where the ROM goes, size is its file's
+func (r ROM) Region(size int) d8224.Region {
+    return region(r.Addr, size, r.Mask)
+}
+
+func (r RAM) Region() d8224.Region {
+    return region(r.Addr, int(r.size()), r.Mask)
+}
+
+func (d Device) size() uint32 {
+    if d.Size == 0 {
+        return device_sizes[d.Type]
+    }
+    return d.Size
+}
+
+func (d Device) Region() d8224.Region {
+    return region(d.Addr, int(d.size()), d.Mask)
+}
+
+// The board's devices, with the sound PIA at $0400 first if it doesn't have
+// an m6821
+func (b *Board) DeviceList() []Device {
+    for _, dev := range b.Devices {
+        if dev.Type == "m6821" {
+            return b.Devices
+        }
+    }
+    return append([]Device{{Type:"m6821", Addr:0x0400}}, b.Devices...)
+}
+
+func (r RAM) size() uint32 {
+    if r.Size == 0 {
+        return 1
+    }
+    return r.Size
+}
+
+func (r RAM) Bytes() []uint8 {
+    return make([]uint8, r.size())
+}
+
+func (b *Board) Variant() (m6800.Variant, error) {
+    if b.CPU == "" {
+        return m6800.MC6800, nil
+    }
+    return m6800.ParseVariant(b.CPU)
+}
+
+func (b *Board) CPUClock() (m6800.Clock, error) {
+    if b.Clock == "" {
+        return m6800.PinballClock, nil
+    }
+    return m6800.ParseClock(b.Clock)
+}
+
+// The PIA port the sound command is written to, and whether it's inverted
+func (b *Board) CommandPort() (uint16, bool) {
+    in := default_input
+    if b.Input != nil {
+        in = *b.Input
+    }
+    if in.Port == "A" {
+        return 0, in.Invert
+    }
+    return 1, in.Invert
+}
+
+// Where the ROM's file is, the path it was given with
+func (b *Board) Path(rom ROM) string {
+    if filepath.IsAbs(rom.File) {
+        return rom.File
+    }
+    return filepath.Join(b.dir, rom.File)
+}
+
+// Read a ROM and check it against its checksums
+func (b *Board) Read(rom ROM) ([]uint8, error) {
+    data, err := ioutil.ReadFile(b.Path(rom))
+    if err != nil {
+        return nil, err
+    }
+    if int(rom.Addr) + len(data) > 1<<16 {
+        return nil, fmt.Errorf("%s: %d bytes at $%.4X runs past $FFFF", rom.File, len(data), uint16(rom.Addr))
+    }
+    if rom.CRC32 != "" {
+        if sum := fmt.Sprintf("%.8x", crc32.ChecksumIEEE(data)); !strings.EqualFold(sum, rom.CRC32) {
+            return nil, fmt.Errorf("%s: crc32 is %s, expected %s", rom.File, sum, strings.ToLower(rom.CRC32))
+        }
+    }
+    if rom.SHA1 != "" {
+        if sum := fmt.Sprintf("%x", sha1.Sum(data)); !strings.EqualFold(sum, rom.SHA1) {
+            return nil, fmt.Errorf("%s: sha1 is %s, expected %s", rom.File, sum, strings.ToLower(rom.SHA1))
+        }
+    }
+    return data, nil
+}
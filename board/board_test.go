@@ -0,0 +1,229 @@
+package board
+
+import (
+    "io/ioutil"
+    "path/filepath"
+    "strings"
+    "testing"
+
+    "github.com/bartgrantham/fpemu/cpu/m6800"
+    "github.com/bartgrantham/fpemu/mem"
+    "github.com/bartgrantham/fpemu/mem/d8224"
+    "github.com/bartgrantham/fpemu/misc/latch"
+    "github.com/bartgrantham/fpemu/pia/m6821"
+)
+
+func TestBuiltin(t *testing.T) {
+    names := Names()
+    if len(names) == 0 {
+        t.Fatal("no built-in boards")
+    }
+    for _, name := range names {
+        b, ok := Builtin(name)
+        if !ok {
+            t.Errorf("%s: not found", name)
+            continue
+        }
+        if b.Name != name {
+            t.Errorf("%s: named %q", name, b.Name)
+        }
+    }
+    b, _ := Builtin("defender")
+    if clock, _ := b.CPUClock(); clock != m6800.VideoClock {
+        t.Errorf("defender clock is %s, want %s", clock, m6800.VideoClock)
+    }
+    if len(b.RAM) != 1 || b.RAM[0].Addr != 0xEFFD || len(b.RAM[0].Bytes()) != 1 {
+        t.Errorf("defender RAM is %v", b.RAM)
+    }
+    if r := b.DeviceList()[0].Region(); r != (d8224.Region{Base:0x0400, Size:4, Mask:0x7FFF}) {
+        t.Errorf("defender PIA is at %s", r)
+    }
+    if port, invert := b.CommandPort(); port != 1 || !invert {
+        t.Errorf("defender commands go to port %d, inverted %v", port, invert)
+    }
+    if _, ok := Builtin("nosuchboard"); ok {
+        t.Error("found a board that doesn't exist")
+    }
+}
+
+func TestParse(t *testing.T) {
+    good := `{
+        "name":"test", "cpu":"hd6301", "clock":"4000000/4",
+        "rom":[{"addr":"$F000", "mask":"BFFF", "file":"sound.rom", "crc32":"0123ABCD"}],
+        "ram":[{"addr":"0x1000", "size":256}, {"addr":4096}],
+        "devices":[{"type":"latch", "addr":"3000", "size":2}, {"type":"m6821", "addr":"2000"}],
+        "input":{"port":"A", "invert":false}
+    }`
+    b, err := Parse(strings.NewReader(good), "roms")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if v, _ := b.Variant(); v != m6800.HD6301 {
+        t.Errorf("cpu is %v", v)
+    }
+    if r := b.ROM[0].Region(0x1000); r != (d8224.Region{Base:0xF000, Size:0x1000, Mask:0xBFFF}) {
+        t.Errorf("ROM region is %s", r)
+    }
+    if devs := b.DeviceList(); len(devs) != 2 || devs[0].Region() != d8224.Span(0x3000, 2) || devs[1].Region() != d8224.Span(0x2000, 4) {
+        t.Errorf("devices are %v", devs)
+    }
+    if b.ROM[0].Addr != 0xF000 || b.Path(b.ROM[0]) != filepath.Join("roms", "sound.rom") {
+        t.Errorf("ROM is %v at %s", b.ROM[0], b.Path(b.ROM[0]))
+    }
+    if b.RAM[0].Addr != 0x1000 || len(b.RAM[0].Bytes()) != 256 || b.RAM[1].Addr != 0x1000 {
+        t.Errorf("RAM is %v", b.RAM)
+    }
+    if port, invert := b.CommandPort(); port != 0 || invert {
+        t.Errorf("commands go to port %d, inverted %v", port, invert)
+    }
+
+    for _, tc := range []struct{ json, err string }{
+        {`{"name":"x", "rom":[]}`, "no ROMs"},
+        {`{"name":"x", "rom":[{"addr":"F800", "file":"a"}], "cpu":"z80"}`, "z80"},
+        {`{"name":"x", "rom":[{"addr":"F800", "file":"a"}], "clock":"fast"}`, "clock"},
+        {`{"name":"x", "rom":[{"addr":"G800", "file":"a"}]}`, "invalid address"},
+        {`{"name":"x", "rom":[{"addr":"0010", "file":"a"}]}`, "internal RAM"},
+        {`{"name":"x", "rom":[{"addr":"F800", "file":"a", "crc32":"123"}]}`, "crc32"},
+        {`{"name":"x", "rom":[{"addr":"F800", "file":"a", "sha1":"abcd"}]}`, "sha1"},
+        {`{"name":"x", "rom":[{"addr":"F800", "file":"a"}], "ram":[{"addr":"FFFF", "size":2}]}`, "invalid RAM"},
+        {`{"name":"x", "rom":[{"addr":"F800", "file":"a"}], "devices":[{"type":"ay8910", "addr":"2000"}]}`, "unknown device"},
+        {`{"name":"x", "rom":[{"addr":"F800", "file":"a"}], "devices":[{"type":"m6821", "addr":"2000", "size":8}]}`, "4 registers"},
+        {`{"name":"x", "rom":[{"addr":"F800", "file":"a"}], "devices":[{"type":"latch", "addr":"FFFF", "size":2}]}`, "invalid latch"},
+        {`{"name":"x", "rom":[{"addr":"F800", "file":"a"}], "input":{"port":"C"}}`, "input port"},
+        {`{"name":"x", "rom":[{"addr":"F800", "file":"a"}], "mirrors":[]}`, "unknown field"},
+    } {
+        _, err := Parse(strings.NewReader(tc.json), ".")
+        if err == nil || !strings.Contains(err.Error(), tc.err) {
+            t.Errorf("%s: got %v, want an error about %q", tc.json, err, tc.err)
+        }
+    }
+}
+
+func TestRead(t *testing.T) {
+    dir := t.TempDir()
+    if err := ioutil.WriteFile(filepath.Join(dir, "sound.rom"), []byte("hello"), 0644); err != nil {
+        t.Fatal(err)
+    }
+    // crc32 and sha1 of "hello"
+    b, err := Parse(strings.NewReader(`{"name":"x", "rom":[
+        {"addr":"F800", "file":"sound.rom", "crc32":"3610A686", "sha1":"aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d"},
+        {"addr":"F800", "file":"sound.rom", "crc32":"00000000"},
+        {"addr":"FFFE", "file":"sound.rom"}
+    ]}`), dir)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if data, err := b.Read(b.ROM[0]); err != nil || string(data) != "hello" {
+        t.Errorf("got %q, %v", data, err)
+    }
+    if _, err := b.Read(b.ROM[1]); err == nil || !strings.Contains(err.Error(), "crc32 is 3610a686") {
+        t.Errorf("bad checksum got %v", err)
+    }
+    if _, err := b.Read(b.ROM[2]); err == nil || !strings.Contains(err.Error(), "past $FFFF") {
+        t.Errorf("overlong ROM got %v", err)
+    }
+}
+
+func TestFromSpecs(t *testing.T) {
+    b, err := FromSpecs("cli", []string{"f000=sound.rom", "RAM=EFFD,1000-1100", "CPU=nsc8105", "CLOCK=3579545/4"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(b.ROM) != 1 || b.ROM[0].Addr != 0xF000 || b.Path(b.ROM[0]) != "sound.rom" {
+        t.Errorf("ROM is %v", b.ROM)
+    }
+    if len(b.RAM) != 2 || b.RAM[0].size() != 1 || b.RAM[1].Addr != 0x1000 || b.RAM[1].size() != 0x100 {
+        t.Errorf("RAM is %v", b.RAM)
+    }
+    if v, _ := b.Variant(); v != m6800.NSC8105 {
+        t.Errorf("cpu is %v", v)
+    }
+    if devs := b.DeviceList(); len(devs) != 1 || devs[0].Region() != d8224.Span(0x0400, 4) {
+        t.Errorf("devices are %v, want the PIA at $0400", devs)
+    }
+    for _, specs := range [][]string{
+        {"RAM=EFFD"},
+        {"f000"},
+        {"f000=sound.rom", "RAM=2000-1000"},
+        {"f000=sound.rom", "CLOCK=0"},
+    } {
+        if _, err := FromSpecs("cli", specs); err == nil {
+            t.Errorf("%v should be an error", specs)
+        }
+    }
+}
+
+// a built-in board mapped the way the emulator does it, with ROMs the size of
+// the dumps that hold the high nibbles of their offsets
+func mount_builtin(t *testing.T, name string, sizes ...int) (*d8224.D8224Mem, *m6821.M6821) {
+    b, _ := Builtin(name)
+    var pia *m6821.M6821
+    mmu := d8224.NewD8224Mem(nil)
+    for _, dev := range b.DeviceList() {
+        var d mem.Device
+        switch dev.Type {
+            case "m6821":
+                p := &m6821.M6821{}
+                if pia == nil {
+                    pia = p
+                }
+                d = p
+            case "latch":
+                d = latch.NewLatch(dev.Region().Size)
+        }
+        if err := mmu.Attach(dev.Region(), d); err != nil {
+            t.Fatal(err)
+        }
+    }
+    for i, rom := range b.ROM {
+        data := make([]uint8, sizes[i])
+        for j := range data {
+            data[j] = uint8(j >> 4)
+        }
+        if err := mmu.MountRegion(rom.Region(sizes[i]), data, false); err != nil {
+            t.Fatal(err)
+        }
+    }
+    for _, ram := range b.RAM {
+        if err := mmu.MountRegion(ram.Region(), ram.Bytes(), true); err != nil {
+            t.Fatal(err)
+        }
+    }
+    return mmu, pia
+}
+
+func TestBuiltinMirrors(t *testing.T) {
+    // Colony 7 reads its PIA at $8401
+    mmu, pia := mount_builtin(t, "colony7", 0x800)
+    mmu.W8(0x0401, 0x04)
+    if v := mmu.R8(0x8401); v != 0x04 {
+        t.Errorf("colony7 $8401 is 0x%.2X, want CRA", v)
+    }
+    mmu.W8(0x8403, 0x04)
+    if pia.CRB != 0x04 {
+        t.Errorf("colony7 CRB is 0x%.2X after writing $8403", pia.CRB)
+    }
+}
+
+func TestBuiltinROMMirrors(t *testing.T) {
+    // Lotto Fun's ROM doesn't decode A14, its code reads tables at $BF5F
+    mmu, _ := mount_builtin(t, "lottofun", 0x1000)
+    if v := mmu.R8(0xBF5F); v != 0xF5 {
+        t.Errorf("lottofun $BF5F is 0x%.2X, want the ROM's $FF5F", v)
+    }
+}
+
+func TestBuiltinDevices(t *testing.T) {
+    // the second generation boards have their PIA at $2000, and write CRA
+    // at $2001 first thing
+    for _, name := range []string{"inferno", "mysticmarathon", "turkeyshoot"} {
+        mmu, pia := mount_builtin(t, name, 0x2000)
+        mmu.W8(0x2001, 0x04)
+        if pia.CRA != 0x04 {
+            t.Errorf("%s CRA is 0x%.2X after writing $2001", name, pia.CRA)
+        }
+        if v := mmu.R8(0x3FFD); v != 0x04 {
+            t.Errorf("%s $3FFD is 0x%.2X, want the CRA mirror", name, v)
+        }
+    }
+}
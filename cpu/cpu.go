@@ -4,7 +4,25 @@ import (
     "github.com/bartgrantham/fpemu/mem"
 )
 
-type interface CPU16 {
-    Step(mmu mem.MMU) error
-    Disasm(pc uint16, mmu mem.MMU16) (string, uint16) {
+// a programmer-visible register, Flags is the bit legend (MSB first) for a
+// condition code register and empty otherwise
+type Register struct {
+    Name   string
+    Bits   int
+    Flags  string
+}
+
+type CPU16 interface {
+    Name() string
+    Step(mmu mem.MMU16) (int, error)  // execute one instruction, returns cycles used
+    Disasm(pc uint16, mmu mem.MMU16) (string, uint16)
+    Reset(mmu mem.MMU16)
+    IRQ(assert bool)                  // drive the maskable, level-sensitive interrupt line
+    NMI(assert bool)                  // drive the non-maskable interrupt line, latched on assert
+    Regs() []Register                 // in display order
+    Reg(name string) uint16
+    SetReg(name string, val uint16)
+    Cycles() uint64                   // total cycles executed
+    Halted() error                    // why the CPU stopped, nil while running
+    Status() string
 }
@@ -0,0 +1,395 @@
+package m6800
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+)
+
+// A small two-pass assembler for the Motorola syntax the disassembler writes,
+// enough to check that its output rebuilds the ROM:
+//
+//     label   mnemonic  operand    ; comment
+//     name    equ       $0400
+//             org       $F800
+//             fcb       $01,$02
+//             fdb       label
+//
+// Operands are #imm, addr, <addr (direct), >addr (extended), off,x, and for
+// the HD6301 #imm,addr and #imm,off,x.  Expressions are numbers ($hex, 0xhex,
+// %binary, decimal, 'c'), labels and *, joined with + and -.  A line starting
+// with "*" is a comment.
+
+// table mnemonics that assemblers spell differently
+var asm_names = map[string]string{
+    "lda":"ldaa", "ldb":"ldab", "sta":"staa", "stb":"stab",
+    "ora":"oraa", "orb":"orab", "_std":"std", "cmpx":"cpx",
+}
+
+func asm_mnemonic(mnemonic string) string {
+    if name, ok := asm_names[mnemonic]; ok {
+        return name
+    }
+    return mnemonic
+}
+
+type opkey struct {
+    mnemonic  string
+    mode      Alignment
+}
+
+// the documented opcode for each mnemonic and mode on this CPU
+func (c *M6800) opcodes() map[opkey]uint8 {
+    plain := &M6800{Variant:c.Variant}
+    ops := map[opkey]uint8{}
+    for raw := 0; raw < 256; raw++ {
+        desc, legal := plain.opdesc(uint8(raw))
+        if !legal {
+            continue
+        }
+        key := opkey{asm_mnemonic(desc.Mnemonic), desc.AddrMode}
+        if _, dup := ops[key]; !dup {
+            ops[key] = uint8(raw)
+        }
+    }
+    return ops
+}
+
+type asmline struct {
+    num      int
+    label    string
+    op       string
+    args     string
+    pc       uint16
+    mode     Alignment  // picked in the first pass, so both passes agree on sizes
+}
+
+type AsmError struct {
+    Line  int
+    Msg   string
+}
+
+func (e AsmError) Error() string {
+    return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+type assembler struct {
+    ops     map[opkey]uint8
+    labels  map[string]uint16
+    image   map[uint16]uint8
+}
+
+// Assemble source for this CPU, returns the byte at each address it fills
+func (c *M6800) Assemble(src string) (map[uint16]uint8, error) {
+    a := &assembler{ops:c.opcodes(), labels:map[string]uint16{}, image:map[uint16]uint8{}}
+    var lines []*asmline
+    for i, text := range strings.Split(src, "\n") {
+        if line := parse_asmline(i+1, text); line != nil {
+            lines = append(lines, line)
+        }
+    }
+    // first pass: addresses of the labels
+    pc := uint16(0)
+    for _, line := range lines {
+        line.pc = pc
+        if line.op == "equ" {
+            if line.label == "" {
+                return nil, AsmError{line.num, "equ without a name"}
+            }
+            val, ok, err := a.eval(line.args, pc, false)
+            if err != nil || !ok {
+                return nil, AsmError{line.num, fmt.Sprintf("equ needs a value defined above it: %q", line.args)}
+            }
+            a.labels[line.label] = val
+            continue
+        }
+        if line.label != "" {
+            if _, dup := a.labels[line.label]; dup {
+                return nil, AsmError{line.num, fmt.Sprintf("%s defined twice", line.label)}
+            }
+            a.labels[line.label] = pc
+        }
+        size, err := a.size(line)
+        if err != nil {
+            return nil, AsmError{line.num, err.Error()}
+        }
+        if line.op == "org" {
+            pc = size
+            continue
+        }
+        pc += size
+    }
+    // second pass: the bytes
+    for _, line := range lines {
+        if err := a.emit(line); err != nil {
+            return nil, AsmError{line.num, err.Error()}
+        }
+    }
+    return a.image, nil
+}
+
+// split a line into label, operation and operand, nil if there's nothing on it
+func parse_asmline(num int, text string) *asmline {
+    if strings.HasPrefix(text, "*") {
+        return nil
+    }
+    if i := strings.IndexByte(text, ';'); i > -1 {
+        text = text[:i]
+    }
+    line := &asmline{num:num}
+    fields := strings.Fields(text)
+    if len(fields) == 0 {
+        return nil
+    }
+    if text[0] != ' ' && text[0] != '\t' {
+        line.label = strings.TrimSuffix(fields[0], ":")
+        fields = fields[1:]
+    }
+    if len(fields) > 0 {
+        line.op = strings.ToLower(fields[0])
+    }
+    if len(fields) > 1 {
+        line.args = strings.Join(fields[1:], "")
+    }
+    return line
+}
+
+// bytes the line takes, or the new pc for org
+func (a *assembler) size(line *asmline) (uint16, error) {
+    switch line.op {
+        case "":
+            return 0, nil
+        case "org":
+            val, ok, err := a.eval(line.args, line.pc, false)
+            if err != nil || !ok {
+                return 0, fmt.Errorf("org needs a value defined above it: %q", line.args)
+            }
+            return val, nil
+        case "fcb":
+            return uint16(len(split_args(line.args))), nil
+        case "fdb":
+            return uint16(2 * len(split_args(line.args))), nil
+        case "end":
+            return 0, nil
+    }
+    mode, err := a.mode(line)
+    if err != nil {
+        return 0, err
+    }
+    line.mode = mode
+    return mode_length[mode], nil
+}
+
+// the addressing mode from the operand's syntax, direct over extended if the
+// address is already known and fits in a byte
+func (a *assembler) mode(line *asmline) (Alignment, error) {
+    args := strings.ToLower(line.args)
+    has := func(mode Alignment) bool {
+        _, ok := a.ops[opkey{line.op, mode}]
+        return ok
+    }
+    pick := func(modes ...Alignment) (Alignment, error) {
+        for _, mode := range modes {
+            if has(mode) {
+                return mode, nil
+            }
+        }
+        return Inh, fmt.Errorf("%s %s: no such instruction", line.op, line.args)
+    }
+    switch {
+        case args == "":
+            return pick(Inh, Sx1)
+        case strings.HasPrefix(args, "#"):
+            switch len(split_args(args)) {
+                case 1:
+                    return pick(Imb, Imw)
+                case 2:
+                    return pick(Imd)
+                default:
+                    return pick(Imx)
+            }
+        case strings.HasSuffix(args, ",x"):
+            return pick(Idx)
+        case has(Rel):
+            return Rel, nil
+        case strings.HasPrefix(args, "<"):
+            return pick(Dir)
+        case strings.HasPrefix(args, ">"):
+            return pick(Ext)
+    }
+    if val, ok, err := a.eval(line.args, line.pc, false); err == nil && ok && val < 0x100 && has(Dir) {
+        return Dir, nil
+    }
+    return pick(Ext, Dir)
+}
+
+func (a *assembler) put(addr uint16, val uint8) error {
+    if _, dup := a.image[addr]; dup {
+        return fmt.Errorf("$%.4X assembled twice", addr)
+    }
+    a.image[addr] = val
+    return nil
+}
+
+func (a *assembler) emit(line *asmline) error {
+    var out []uint8
+    value := func(expr string) (uint16, error) {
+        val, _, err := a.eval(expr, line.pc, true)
+        return val, err
+    }
+    switch line.op {
+        case "", "equ", "org", "end":
+            return nil
+        case "fcb":
+            for _, arg := range split_args(line.args) {
+                val, err := value(arg)
+                if err != nil {
+                    return err
+                }
+                if val > 0xFF && val < 0xFF80 {
+                    return fmt.Errorf("fcb %s doesn't fit in a byte", arg)
+                }
+                out = append(out, uint8(val))
+            }
+        case "fdb":
+            for _, arg := range split_args(line.args) {
+                val, err := value(arg)
+                if err != nil {
+                    return err
+                }
+                out = append(out, uint8(val>>8), uint8(val))
+            }
+        default:
+            out = append(out, a.ops[opkey{line.op, line.mode}])
+            args := split_args(strings.TrimLeft(line.args, "#<>"))
+            switch line.mode {
+                case Imb, Dir, Idx:
+                    if args[0] == "" {
+                        // ",x" is "0,x"
+                        args[0] = "0"
+                    }
+                    val, err := value(args[0])
+                    if err != nil {
+                        return err
+                    }
+                    out = append(out, uint8(val))
+                case Imw, Ext:
+                    val, err := value(args[0])
+                    if err != nil {
+                        return err
+                    }
+                    out = append(out, uint8(val>>8), uint8(val))
+                case Imd, Imx:
+                    imm, err := value(args[0])
+                    if err != nil {
+                        return err
+                    }
+                    addr, err := value(args[1])
+                    if err != nil {
+                        return err
+                    }
+                    out = append(out, uint8(imm), uint8(addr))
+                case Rel:
+                    target, err := value(args[0])
+                    if err != nil {
+                        return err
+                    }
+                    // wraps around the top of memory, like the CPU
+                    offset := int(int16(target - (line.pc + 2)))
+                    if offset < -128 || offset > 127 {
+                        return fmt.Errorf("branch to $%.4X out of range", target)
+                    }
+                    out = append(out, uint8(int8(offset)))
+            }
+    }
+    for i, val := range out {
+        if err := a.put(line.pc + uint16(i), val); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// operands are comma separated, except inside a character constant
+func split_args(args string) []string {
+    var out []string
+    quoted := false
+    start := 0
+    for i := 0; i < len(args); i++ {
+        switch {
+            case args[i] == '\'':
+                quoted = !quoted
+            case args[i] == ',' && !quoted:
+                out = append(out, args[start:i])
+                start = i + 1
+        }
+    }
+    return append(out, args[start:])
+}
+
+// evaluate an expression, ok is false if it uses a label that isn't defined
+// yet, which is only an error if final is set
+func (a *assembler) eval(expr string, pc uint16, final bool) (val uint16, ok bool, err error) {
+    ok = true
+    sign := uint16(1)
+    if strings.HasPrefix(expr, "-") {
+        sign, expr = 0xFFFF, expr[1:]
+    }
+    for {
+        var term string
+        switch i := strings.IndexAny(expr, "+-"); {
+            case strings.HasPrefix(expr, "'") && len(expr) >= 3:
+                term, expr = expr[:3], expr[3:]
+            case i < 0:
+                term, expr = expr, ""
+            default:
+                term, expr = expr[:i], expr[i:]
+        }
+        var n uint16
+        switch {
+            case term == "":
+                return 0, false, fmt.Errorf("missing value")
+            case term == "*":
+                n = pc
+            case term[0] == '$':
+                n, err = parse_asmnum(term[1:], 16)
+            case strings.HasPrefix(term, "0x"), strings.HasPrefix(term, "0X"):
+                n, err = parse_asmnum(term[2:], 16)
+            case term[0] == '%':
+                n, err = parse_asmnum(term[1:], 2)
+            case term[0] == '\'':
+                n = uint16(term[1])
+            case term[0] >= '0' && term[0] <= '9':
+                n, err = parse_asmnum(term, 10)
+            default:
+                label, defined := a.labels[term]
+                if !defined {
+                    if final {
+                        return 0, false, fmt.Errorf("%s isn't defined", term)
+                    }
+                    ok = false
+                }
+                n = label
+        }
+        if err != nil {
+            return 0, false, err
+        }
+        val += sign * n
+        if expr == "" {
+            return val, ok, nil
+        }
+        sign = 1
+        if expr[0] == '-' {
+            sign = 0xFFFF
+        }
+        expr = expr[1:]
+    }
+}
+
+func parse_asmnum(text string, base int) (uint16, error) {
+    n, err := strconv.ParseUint(text, base, 16)
+    if err != nil {
+        return 0, fmt.Errorf("bad number %q", text)
+    }
+    return uint16(n), nil
+}
@@ -0,0 +1,124 @@
+package m6800
+
+import (
+    "math/rand"
+    "strings"
+    "testing"
+
+    "github.com/bartgrantham/fpemu/mem/d8224"
+    "github.com/bartgrantham/fpemu/pia/m6821"
+)
+
+func TestAssemble(t *testing.T) {
+    src := `
+* a comment
+PIA     equ   $0400
+zp      equ   $10
+        org   $F800
+start:  ldaa  #'A'          ; $86 $41
+        staa  PIA           ; extended
+        staa  zp            ; direct
+        staa  >zp           ; forced extended
+        ldx   #table
+        ldab  2,x
+        jmp   ,x
+loop    bra   loop
+        bne   *-2
+table   fdb   start,loop
+        fcb   1,$FF,%101,-1
+`
+    image, err := (&M6800{}).Assemble(src)
+    if err != nil {
+        t.Fatal(err)
+    }
+    want := []uint8{
+        0x86, 0x41,
+        0xB7, 0x04, 0x00,
+        0x97, 0x10,
+        0xB7, 0x00, 0x10,
+        0xCE, 0xF8, 0x15,
+        0xE6, 0x02,
+        0x6E, 0x00,
+        0x20, 0xFE,
+        0x26, 0xFC,
+        0xF8, 0x00, 0xF8, 0x11,
+        0x01, 0xFF, 0x05, 0xFF,
+    }
+    if len(image) != len(want) {
+        t.Errorf("%d bytes, want %d", len(image), len(want))
+    }
+    for i, b := range want {
+        if got, ok := image[0xF800 + uint16(i)]; !ok || got != b {
+            t.Errorf("$%.4X is 0x%.2X (%v), want 0x%.2X", 0xF800+i, got, ok, b)
+        }
+    }
+
+    for _, bad := range []string{
+        " org $F800\n ldaa nowhere\n",
+        " org $F800\nhere bra there\n org $F900\nthere nop\n",
+        " org $F800\n aim #1,2\n",
+        " org $F800\n nop\n org $F800\n nop\n",
+    } {
+        if _, err := (&M6800{}).Assemble(bad); err == nil {
+            t.Errorf("assembled %q", bad)
+        }
+    }
+}
+
+// whatever the trace makes of a ROM, the source has to rebuild it
+func TestAsmRoundTrip(t *testing.T) {
+    for _, variant := range []Variant{MC6800, MC6801, HD6301, NSC8105} {
+        for seed := int64(0); seed < 8; seed++ {
+            rng := rand.New(rand.NewSource(seed))
+            rom := make([]uint8, 0x1000)
+            rng.Read(rom)
+            // vectors somewhere into the ROM
+            for i := 0xFF0; i < 0x1000; i += 2 {
+                rom[i] = 0xF0 + uint8(rng.Intn(16))
+            }
+            pia := &m6821.M6821{}
+            mmu := d8224.NewD8224Mem(pia)
+            if err := mmu.Mount(0xF000, rom, false); err != nil {
+                t.Fatal(err)
+            }
+            m := NewM6800(mmu, pia)
+            m.Variant = variant
+            m.Undocumented = true
+            listing := m.DisasmTrace(mmu)
+            if err := listing.Verify(); err != nil {
+                t.Errorf("%s, seed %d: %v", variant, seed, err)
+            }
+        }
+    }
+}
+
+func TestAsmLabels(t *testing.T) {
+    rom := make([]uint8, 0x800)
+    copy(rom, dispatcher)
+    rom[0x7F8], rom[0x7F9] = 0xF8, 0x0C
+    rom[0x7FE], rom[0x7FF] = 0xF8, 0x00
+    pia := &m6821.M6821{}
+    mmu := d8224.NewD8224Mem(pia)
+    if err := mmu.Mount(0xF800, rom, false); err != nil {
+        t.Fatal(err)
+    }
+    m := NewM6800(mmu, pia)
+    m.Symbols.AddPIA("PIA", 0x0400)
+    m.Symbols.Add("idle", 0xF804)
+    m.Symbols.Add("SOUND_TABLE", 0x1000)
+    text := strings.Join(m.DisasmTrace(mmu).Asm(), "\n")
+    for _, want := range []string{
+        "PIA_PA  equ   $0400",
+        "SOUND_TABLE equ   $1000",
+        "        org   $F800",
+        "idle    wai                     ; $F804  3E",
+        "        bra   idle              ; $F805  20FD",
+        "LF80C   ldx   #LF81A            ; $F80C  CEF81A",
+        "LF81A   fdb   LF81E             ; $F81A  F81E",
+        "RESET_VECTOR:\n        fdb   LF800",
+    } {
+        if !strings.Contains(text, want) {
+            t.Errorf("source is missing %q", want)
+        }
+    }
+}
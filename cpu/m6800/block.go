@@ -0,0 +1,170 @@
+package m6800
+
+import (
+    "github.com/bartgrantham/fpemu/mem"
+)
+
+// Basic-block execution for the audio path
+// Step does everything for every instruction: samples the interrupt lines,
+// sets up a recover, keeps the lookback, fetches and looks up the opcode.
+// Exec decodes a run of straight-line instructions once, caches it by PC,
+// and then runs the whole run with one recover.  The interrupt lines are still
+// sampled after every instruction, and a block ends early where one is due, so
+// interrupts are taken on the same instruction as with Step, and so is the bus
+// timing of each instruction.
+//
+// A write to a byte a cached block was decoded from throws the cache away.
+
+const max_block = 32
+
+type blockop struct {
+    pc      uint16
+    code    uint8
+    fn      func(*M6800, mem.MMU16)
+    cycles  int
+}
+
+type block struct {
+    ops  []blockop
+}
+
+type blockcache struct {
+    blocks  [1<<16]*block
+    code    [1<<16/8]uint8  // bitmap of bytes the cached blocks were decoded from
+    gen     int             // bumped on every flush, so a running block can notice
+}
+
+func (c *blockcache) is_code(addr uint16) bool {
+    return c.code[addr>>3] & (1 << (addr&7)) != 0
+}
+
+func (c *blockcache) flush() {
+    c.blocks = [1<<16]*block{}
+    c.code = [1<<16/8]uint8{}
+    c.gen += 1
+}
+
+// Throw away the decoded blocks, for anything that changes memory behind the
+// CPU's back (a debugger, a ROM swap)
+func (m *M6800) Invalidate() {
+    if m.cache != nil {
+        m.cache.flush()
+    }
+}
+
+// these change the flow of control or the interrupt mask, so they end a block
+var block_enders = map[string]bool{
+    "jmp":true, "jsr":true, "bsr":true, "rts":true, "rti":true,
+    "swi":true, "wai":true, "slp":true, "cli":true, "tap":true, "hcf":true,
+}
+
+// decode from pc until something that changes the flow, or memory that can't
+// be read, nil if there's nothing decodable at pc
+func (m *M6800) decode_block(mmu mem.MMU16, pc uint16) *block {
+    ops, cycles := m.tables()
+    b := &block{}
+    for len(b.ops) < max_block {
+        if ok, _ := mmu.Valid(pc); !ok {
+            break
+        }
+        raw := mmu.Peek8(pc)
+        desc, legal := m.opdesc(raw)
+        invalid := !legal || cycles[raw] == 0
+        b.ops = append(b.ops, blockop{pc, raw, ops[raw], cycles[raw]})
+        length := mode_length[desc.AddrMode]
+        for i := uint16(0); i < length; i++ {
+            m.cache.code[(pc+i)>>3] |= 1 << ((pc+i)&7)
+        }
+        if invalid || desc.AddrMode == Rel || block_enders[desc.Mnemonic] {
+            break
+        }
+        pc += length
+    }
+    if len(b.ops) == 0 {
+        return nil
+    }
+    return b
+}
+
+// Run whole blocks until at least budget cycles have gone by, returns the
+// cycles actually used.  It stops early, without an error, when the CPU parks
+// in WAI/SLP so the caller can skip ahead.  With Debug or Trace set it just
+// calls Step.
+func (m *M6800) Exec(mmu mem.MMU16, budget int) (count int, err error) {
+    if m.Debug || m.Trace != nil {
+        for count < budget {
+            n, err := m.Step(mmu)
+            count += n
+            if err != nil || m.parked() {
+                return count, err
+            }
+        }
+        return count, nil
+    }
+    if m.Fault != nil {
+        return 0, m.Fault
+    }
+    if m.cache == nil {
+        m.cache = &blockcache{}
+        m.bus.cache = m.cache
+    }
+    var op blockop
+    snapshot := m.Registers
+    defer func() {
+        if r := recover(); r != nil {
+            fault, ok := r.(mem.AccessError)
+            if !ok {
+                panic(r)
+            }
+            m.Registers = snapshot
+            m.Fault = BusFault{Addr:fault.Addr, Write:fault.Write, PC:m.PC, Opcode:op.code, CPU:snapshot}
+            err = m.Fault
+        }
+    }()
+    m.bus.attach(mmu)
+    for count < budget {
+        if n, idle := m.service(mmu); idle {
+            count += n
+            if m.parked() {
+                return count, nil
+            }
+            continue
+        }
+        b := m.cache.blocks[m.PC]
+        if b == nil {
+            if b = m.decode_block(mmu, m.PC); b == nil {
+                // let Step report why
+                n, err := m.Step(mmu)
+                return count + n, err
+            }
+            m.cache.blocks[m.PC] = b
+        }
+        gen := m.cache.gen
+        for _, op = range b.ops {
+            if m.PC != op.pc {
+                // something jumped that the decode didn't expect to
+                break
+            }
+            snapshot = m.Registers
+            m.op = op.code
+            m.PC += 1
+            m.bus.next(m.cycles, op.cycles)
+            op.fn(m, &m.bus)
+            m.bus.flush()
+            if m.Fault != nil {
+                return count, m.Fault
+            }
+            m.cycles += uint64(op.cycles)
+            count += op.cycles
+            if m.cache.gen != gen {
+                // wrote over code, possibly this block
+                break
+            }
+            if _, due := m.sample(); due {
+                // a device raised a line, service takes it next time round
+                break
+            }
+        }
+    }
+    return count, nil
+}
@@ -0,0 +1,216 @@
+package m6800
+
+import (
+    "io/ioutil"
+    "path/filepath"
+    "testing"
+
+    "github.com/bartgrantham/fpemu/mem/d8224"
+    "github.com/bartgrantham/fpemu/pia"
+    "github.com/bartgrantham/fpemu/pia/m6821"
+)
+
+// the shape of the Williams sound ROM synth loops: set up the PIA, then
+// accumulate a phase in RAM and write it to the DAC, forever
+var sawtooth = []uint8{
+    0x8E, 0x00, 0x7F,        // F800  lds   #$007F
+    0x86, 0xFF,              // F803  ldaa  #$FF
+    0xB7, 0x04, 0x00,        // F805  staa  $0400   DDRA, all outputs
+    0x86, 0x04,              // F808  ldaa  #$04
+    0xB7, 0x04, 0x01,        // F80A  staa  $0401   CRA, select ORA
+    0xC6, 0x20,              // F80D  ldab  #$20
+    0x96, 0x10,              // F80F  ldaa  $10
+    0x9B, 0x11,              // F811  adda  $11
+    0x97, 0x10,              // F813  staa  $10
+    0xB7, 0x04, 0x00,        // F815  staa  $0400   DAC
+    0x5A,                    // F818  decb
+    0x26, 0xF4,              // F819  bne   $F80F
+    0x7C, 0x00, 0x11,        // F81B  inc   $11
+    0x20, 0xED,              // F81E  bra   $F80D
+}
+
+func sawtooth_board(t testing.TB) (*M6800, *d8224.D8224Mem) {
+    rom := make([]uint8, 0x800)
+    copy(rom, sawtooth)
+    rom[0x7FE], rom[0x7FF] = 0xF8, 0x00
+    pia := &m6821.M6821{}
+    mmu := d8224.NewD8224Mem(pia)
+    if err := mmu.Mount(0xF800, rom, false); err != nil {
+        t.Fatal(err)
+    }
+    if err := mmu.Mount(0x0100, make([]uint8, 0x100), true); err != nil {
+        t.Fatal(err)
+    }
+    return NewM6800(mmu, pia), mmu
+}
+
+// run one board a block at a time with Exec and the other an instruction at
+// a time with Step, they have to agree after every block
+func lockstep(t *testing.T, setup func(*M6800, *d8224.D8224Mem)) {
+    stepped, smmu := sawtooth_board(t)
+    blocked, bmmu := sawtooth_board(t)
+    setup(stepped, smmu)
+    setup(blocked, bmmu)
+    for i := 0; i < 1000; i++ {
+        if _, err := blocked.Exec(bmmu, 1); err != nil {
+            t.Fatal(err)
+        }
+        for stepped.Cycles() < blocked.Cycles() {
+            if _, err := stepped.Step(smmu); err != nil {
+                t.Fatal(err)
+            }
+        }
+        if stepped.Cycles() != blocked.Cycles() {
+            t.Fatalf("Exec stopped at cycle %d, between instructions (%d)", blocked.Cycles(), stepped.Cycles())
+        }
+        if stepped.Registers != blocked.Registers {
+            t.Fatalf("at cycle %d\n     Step %s\n     Exec %s", stepped.Cycles(), stepped.Status(), blocked.Status())
+        }
+        if smmu.RxM != bmmu.RxM {
+            t.Fatalf("at cycle %d memory differs", stepped.Cycles())
+        }
+    }
+}
+
+func TestExecMatchesStep(t *testing.T) {
+    lockstep(t, func(*M6800, *d8224.D8224Mem) {})
+}
+
+// a write over decoded code has to be seen straight away
+func TestExecSelfModifying(t *testing.T) {
+    lockstep(t, func(m *M6800, mmu *d8224.D8224Mem) {
+        // alternates between INCA and DECA, so A only stays small if every
+        // patch is picked up
+        program := []uint8{
+            0x4C,                // 0100  inca
+            0xD6, 0x10,          // 0101  ldab  $10
+            0xC8, 0x06,          // 0103  eorb  #$06    INCA <-> DECA
+            0xD7, 0x10,          // 0105  stab  $10
+            0xF7, 0x01, 0x00,    // 0107  stab  $0100
+            0x20, 0xF4,          // 010A  bra   $0100
+        }
+        for i, b := range program {
+            mmu.W8(0x0100 + uint16(i), b)
+        }
+        mmu.W8(0x0010, 0x4C)
+        m.PC = 0x0100
+    })
+}
+
+// stands in for the mainboard, sends a sound command on the first access at
+// or after cycle at, which is in the middle of whatever block is running then
+type command struct {
+    pia  pia.PIA
+    at   uint64
+    sent bool
+}
+
+func (c *command) R8(addr uint16) uint8 { return 0 }
+func (c *command) Peek8(addr uint16) uint8 { return 0 }
+func (c *command) W8(addr uint16, val uint8) {}
+func (c *command) Reset() {}
+
+func (c *command) Tick(cycle uint64) {
+    if cycle >= c.at && !c.sent {
+        c.pia.Write(1, 0x3F)
+        c.sent = true
+    }
+}
+
+// an IRQ raised partway through a block is taken after the same instruction
+// Step takes it after
+func TestExecIRQ(t *testing.T) {
+    for _, at := range []uint64{101, 150, 203, 260} {
+        lockstep(t, func(m *M6800, mmu *d8224.D8224Mem) {
+            if err := mmu.Attach(d8224.Span(0x2000, 1), &command{pia:m.PIA, at:at}); err != nil {
+                t.Fatal(err)
+            }
+            // the IRQ vector is blank, so the handler is at $0000
+            mmu.W8(0x0000, 0x4C)    // 0000  inca
+            mmu.W8(0x0001, 0x20)    // 0001  bra   $0000
+            mmu.W8(0x0002, 0xFD)
+            m.CC &^= I
+        })
+    }
+}
+
+const bench_cycles = 100000
+
+// the benchmarks run Defender's sound ROM (defend.snd at $F800) playing
+// command $0A when the dump is there (see board/builtin/defender.json), so
+// they time the synth loops a shipped ROM really spends its cycles in, and
+// the sawtooth loop when it isn't
+const bench_command = 0x0A ^ 0xFF   // the mainboard's lines are inverted
+
+// restart is called before every run, so a run never times the idle loop
+func bench_board(b *testing.B) (m *M6800, mmu *d8224.D8224Mem, restart func()) {
+    rom, err := ioutil.ReadFile(filepath.Join("..", "..", "roms", "defender", "defend.snd"))
+    if err != nil {
+        b.Logf("%v, timing the sawtooth loop", err)
+        m, mmu = sawtooth_board(b)
+        return m, mmu, func() {}
+    }
+    pia := &m6821.M6821{}
+    mmu = d8224.NewD8224Mem(pia)
+    if err := mmu.Mount(0xF800, rom, false); err != nil {
+        b.Fatal(err)
+    }
+    if err := mmu.Mount(0xEFFD, make([]uint8, 1), true); err != nil {
+        b.Fatal(err)
+    }
+    m = NewM6800(mmu, pia)
+    // let the reset code set up the PIA and unmask IRQs
+    for m.Cycles() < bench_cycles {
+        if _, err := m.Step(mmu); err != nil {
+            b.Fatal(err)
+        }
+    }
+    return m, mmu, func() { m.PIA.Write(1, bench_command) }
+}
+
+func BenchmarkStep(b *testing.B) {
+    m, mmu, restart := bench_board(b)
+    b.ResetTimer()
+    for i := 0; i < b.N; i++ {
+        restart()
+        for count := 0; count < bench_cycles; {
+            n, err := m.Step(mmu)
+            if err != nil {
+                b.Fatal(err)
+            }
+            count += n
+        }
+    }
+}
+
+func BenchmarkStepDebug(b *testing.B) {
+    m, mmu, restart := bench_board(b)
+    m.Debug = true
+    b.ResetTimer()
+    for i := 0; i < b.N; i++ {
+        restart()
+        for count := 0; count < bench_cycles; {
+            n, err := m.Step(mmu)
+            if err != nil {
+                b.Fatal(err)
+            }
+            count += n
+        }
+    }
+}
+
+func BenchmarkExec(b *testing.B) {
+    m, mmu, restart := bench_board(b)
+    b.ResetTimer()
+    for i := 0; i < b.N; i++ {
+        restart()
+        // about one audio sample's worth at a time, the way Callback calls it
+        for count := 0; count < bench_cycles; {
+            n, err := m.Exec(mmu, 20)
+            if err != nil {
+                b.Fatal(err)
+            }
+            count += n
+        }
+    }
+}
@@ -0,0 +1,119 @@
+package m6800
+
+import (
+    "github.com/bartgrantham/fpemu/mem"
+)
+
+// The instructions are written as if all their accesses happen at once, bus
+// sits between them and the MMU and works out which cycle each one lands on.
+// On the 6800 the operand and data reads come in order right after the opcode
+// fetch, and the writes are the last cycles of the instruction (see the
+// cycle-by-cycle tables in the MC6800 datasheet).  So reads are stamped as
+// they happen, and writes are held until the instruction finishes and then
+// stamped backwards from its last cycle.
+//
+// Nothing on the bus reads back what the same instruction wrote, so holding
+// the writes doesn't change what the instruction sees.
+
+type buswrite struct {
+    addr  uint16
+    val   uint8
+}
+
+type bus struct {
+    mmu      mem.MMU16
+    clk      mem.Clocked  // nil if the MMU doesn't want the timing
+    start    uint64       // cycle the instruction's opcode fetch was on
+    length   int          // cycles the instruction takes
+    reads    int
+    writes   [8]buswrite  // SWI/WAI stack 7 bytes
+    nwrites  int
+    cache    *blockcache  // told about writes over decoded code, nil if none
+}
+
+var _ mem.MMU16 = (*bus)(nil)
+
+func (b *bus) begin(mmu mem.MMU16, start uint64, length int) {
+    b.attach(mmu)
+    b.next(start, length)
+}
+
+func (b *bus) attach(mmu mem.MMU16) {
+    b.mmu = mmu
+    b.clk, _ = mmu.(mem.Clocked)
+}
+
+// the opcode fetch has already happened, on the first cycle
+func (b *bus) next(start uint64, length int) {
+    b.start = start
+    b.length = length
+    b.reads = 1
+    b.nwrites = 0
+}
+
+func (b *bus) stamp(offset int) {
+    if b.clk == nil {
+        return
+    }
+    if offset >= b.length {
+        offset = b.length - 1
+    }
+    if offset < 0 {
+        offset = 0
+    }
+    b.clk.SetCycle(b.start + uint64(offset))
+}
+
+// perform the held writes, in order, ending on the last cycle
+func (b *bus) flush() {
+    for i := 0; i < b.nwrites; i++ {
+        b.stamp(b.length - b.nwrites + i)
+        b.mmu.W8(b.writes[i].addr, b.writes[i].val)
+        if b.cache != nil && b.cache.is_code(b.writes[i].addr) {
+            b.cache.flush()
+        }
+    }
+    b.nwrites = 0
+}
+
+func (b *bus) R8(addr uint16) uint8 {
+    b.stamp(b.reads)
+    b.reads += 1
+    return b.mmu.R8(addr)
+}
+
+func (b *bus) W8(addr uint16, val uint8) {
+    if b.nwrites == len(b.writes) {
+        b.flush()
+    }
+    b.writes[b.nwrites] = buswrite{addr, val}
+    b.nwrites += 1
+}
+
+// big endian, high byte first, each byte is its own bus cycle
+func (b *bus) R16(addr uint16) uint16 {
+    high := b.R8(addr)
+    low := b.R8(addr+1)
+    return (uint16(high)<<8) + uint16(low)
+}
+
+func (b *bus) W16(addr uint16, val uint16) {
+    b.W8(addr, uint8(val>>8))
+    b.W8(addr+1, uint8(val))
+}
+
+func (b *bus) Peek8(addr uint16) uint8 {
+    return b.mmu.Peek8(addr)
+}
+
+func (b *bus) Valid(addr uint16) (bool, bool) {
+    return b.mmu.Valid(addr)
+}
+
+func (b *bus) Heat(start, end uint16) ([]uint8, []int, []int) {
+    return b.mmu.Heat(start, end)
+}
+
+func (b *bus) String() string {
+    return b.mmu.String()
+}
@@ -0,0 +1,69 @@
+package m6800
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+)
+
+// A CPU clock as the board makes it, a crystal and what it's divided by (the
+// 6802 divides its crystal by 4), kept exact so the emulated time doesn't
+// drift against the host's over a long run.
+type Clock struct {
+    Hz       uint64
+    Divider  uint64
+}
+
+// The Williams video game sound boards run off the NTSC colorburst crystal,
+// the System 4-7 pinball sound boards off a plain 3.58MHz one
+var (
+    VideoClock    = Clock{3579545, 4}
+    PinballClock  = Clock{3580000, 4}
+)
+
+// cycles per second
+func (c Clock) Rate() float64 {
+    return float64(c.Hz) / float64(c.Divider)
+}
+
+func (c Clock) String() string {
+    return fmt.Sprintf("%d/%d", c.Hz, c.Divider)
+}
+
+// "hz/divider", or just "hz" for an undivided clock
+func ParseClock(spec string) (Clock, error) {
+    c := Clock{Divider:1}
+    parts := strings.Split(spec, "/")
+    if len(parts) > 2 {
+        return Clock{}, fmt.Errorf("invalid clock %q, want hz/divider", spec)
+    }
+    var err error
+    if c.Hz, err = strconv.ParseUint(parts[0], 10, 64); err != nil || c.Hz == 0 {
+        return Clock{}, fmt.Errorf("invalid clock %q, want hz/divider", spec)
+    }
+    if len(parts) == 2 {
+        if c.Divider, err = strconv.ParseUint(parts[1], 10, 64); err != nil || c.Divider == 0 {
+            return Clock{}, fmt.Errorf("invalid clock %q, want hz/divider", spec)
+        }
+    }
+    return c, nil
+}
+
+// Hands out the cycles in each of rate ticks per second, whole cycles each
+// time with the fractions carried, so every second adds up to exactly the
+// clock's rate.
+type pacer struct {
+    num, den  uint64
+    frac      uint64
+}
+
+func (c Clock) pacer(rate uint64) pacer {
+    return pacer{num:c.Hz, den:c.Divider * rate}
+}
+
+func (p *pacer) next() int {
+    p.frac += p.num
+    n := p.frac / p.den
+    p.frac %= p.den
+    return int(n)
+}
@@ -0,0 +1,39 @@
+package m6800
+
+import (
+    "testing"
+)
+
+// a second's worth of samples has to come to exactly a second of cycles,
+// whatever the rounding did along the way
+func TestPacerExact(t *testing.T) {
+    for _, c := range []Clock{VideoClock, PinballClock, {1000000, 1}} {
+        for _, rate := range []uint64{44100, 48000, 100} {
+            pace := c.pacer(rate)
+            total := uint64(0)
+            for i := uint64(0); i < rate * 3; i++ {
+                n := pace.next()
+                if float64(n) < c.Rate() / float64(rate) - 1 || float64(n) > c.Rate() / float64(rate) + 1 {
+                    t.Fatalf("%s at %d/s: tick of %d cycles", c, rate, n)
+                }
+                total += uint64(n)
+            }
+            if want := 3 * c.Hz / c.Divider; total != want {
+                t.Errorf("%s at %d/s: %d cycles in 3s, want %d", c, rate, total, want)
+            }
+        }
+    }
+}
+
+func TestParseClock(t *testing.T) {
+    for spec, want := range map[string]Clock{"3579545/4":VideoClock, "894886":{894886, 1}} {
+        if got, err := ParseClock(spec); err != nil || got != want {
+            t.Errorf("ParseClock(%q) = %v, %v, want %v", spec, got, err, want)
+        }
+    }
+    for _, spec := range []string{"", "3579545/0", "0/4", "fast", "1/2/3"} {
+        if _, err := ParseClock(spec); err == nil {
+            t.Errorf("ParseClock(%q) didn't fail", spec)
+        }
+    }
+}
@@ -0,0 +1,175 @@
+package m6800
+
+import (
+    "fmt"
+
+    "github.com/bartgrantham/fpemu/mem"
+)
+
+// One decoded instruction, for the disassembler, tracer and debugger
+type Instruction struct {
+    PC        uint16
+    Opcode    uint8      // as read, before any NSC-8105 unscrambling
+    Mnemonic  string
+    Mode      Alignment
+    Bytes     []uint8    // opcode and operands, empty if pc couldn't be read
+    Operand   uint16     // immediate value, address, index or branch offset, Imd/Imx: immediate<<8 | address/index
+    Target    uint16     // branch destination, or the address for Dir/Ext/Imd
+    HasTarget bool
+    Symbol    string     // name for the target, or for an Imw operand, "" if none
+    Cycles    int
+    Flags     string     // condition codes it changes, in HINZVC order
+    Legal     bool       // false for opcodes this CPU faults or traps on
+}
+
+// Condition codes each instruction changes, from the flags:XXX in the opcode
+// comments.  Everything not here leaves CC alone.
+var flags_affected = map[string]string{
+    "aba":"HNZVC", "adca":"HNZVC", "adcb":"HNZVC", "adda":"HNZVC", "addb":"HNZVC",
+    "addd":"NZVC", "subd":"NZVC", "addx":"NZVC", "adcx":"NZVC",
+    "anda":"NZV", "andb":"NZV", "bita":"NZV", "bitb":"NZV", "bitx":"NZV",
+    "eora":"NZV", "eorb":"NZV", "ora":"NZV", "orb":"NZV",
+    "lda":"NZV", "ldb":"NZV", "ldd":"NZV", "lds":"NZV", "ldx":"NZV",
+    "sta":"NZV", "stb":"NZV", "_std":"NZV", "sts":"NZV", "stx":"NZV",
+    "tab":"NZV", "tba":"NZV", "aim":"NZV", "oim":"NZV", "eim":"NZV", "tim":"NZV",
+    "cba":"NZVC", "cmpa":"NZVC", "cmpb":"NZVC", "cmpx":"NZV",
+    "sba":"NZVC", "suba":"NZVC", "subb":"NZVC", "sbca":"NZVC", "sbcb":"NZVC",
+    "asl":"NZVC", "asla":"NZVC", "aslb":"NZVC", "asld":"NZVC",
+    "asr":"NZVC", "asra":"NZVC", "asrb":"NZVC",
+    "lsr":"NZVC", "lsra":"NZVC", "lsrb":"NZVC", "lsrd":"NZVC",
+    "rol":"NZVC", "rola":"NZVC", "rolb":"NZVC",
+    "ror":"NZVC", "rora":"NZVC", "rorb":"NZVC",
+    "neg":"NZVC", "nega":"NZVC", "negb":"NZVC", "ngc":"NZVC",
+    "com":"NZVC", "coma":"NZVC", "comb":"NZVC",
+    "clr":"NZVC", "clra":"NZVC", "clrb":"NZVC",
+    "tst":"NZVC", "tsta":"NZVC", "tstb":"NZVC", "daa":"NZVC",
+    "dec":"NZV", "deca":"NZV", "decb":"NZV",
+    "inc":"NZV", "inca":"NZV", "incb":"NZV",
+    "dex":"Z", "inx":"Z", "mul":"C",
+    "clc":"C", "sec":"C", "clv":"V", "sev":"V", "cli":"I", "sei":"I",
+    "swi":"I", "tap":"HINZVC", "rti":"HINZVC",
+}
+
+// instruction length by addressing mode
+var mode_length = map[Alignment]uint16{
+    Inh:1, Sx1:1, Rel:2, Imb:2, Dir:2, Idx:2, Imw:3, Ext:3, Imd:3, Imx:3,
+}
+
+// Decode the instruction at pc as this CPU would run it
+func (c *M6800) Decode(pc uint16, mmu mem.MMU16) (inst Instruction) {
+    inst = Instruction{PC:pc, Mnemonic:"ill"}
+    defer func() {
+        if r := recover(); r != nil {
+            if _, ok := r.(mem.AccessError); !ok {
+                panic(r)
+            }
+            inst = Instruction{PC:pc, Mnemonic:"ill"}
+        }
+    }()
+    inst.Opcode = mmu.Peek8(pc)
+    inst.Bytes = []uint8{inst.Opcode}
+    desc, legal := c.opdesc(inst.Opcode)
+    _, cycles := c.tables()
+    inst.Cycles = cycles[inst.Opcode]
+    if !legal {
+        // the HD6301 traps on these, the rest halt
+        return inst
+    }
+    inst.Mnemonic, inst.Mode, inst.Legal = desc.Mnemonic, desc.AddrMode, true
+    inst.Flags = flags_affected[desc.Mnemonic]
+    if desc.Mnemonic == "cmpx" && (c.Variant == MC6801 || c.Variant == HD6301) {
+        inst.Flags = "NZVC"
+    }
+    for i := uint16(1); i < mode_length[desc.AddrMode]; i++ {
+        inst.Bytes = append(inst.Bytes, mmu.Peek8(pc+i))
+    }
+    switch len(inst.Bytes) {
+        case 2:
+            inst.Operand = uint16(inst.Bytes[1])
+        case 3:
+            inst.Operand = uint16(inst.Bytes[1])<<8 | uint16(inst.Bytes[2])
+    }
+    switch desc.AddrMode {
+        case Rel:
+            inst.Target = pc + 2 + uint16(int8(inst.Bytes[1]))
+            inst.HasTarget = true
+        case Dir, Ext:
+            inst.Target = inst.Operand
+            inst.HasTarget = true
+        case Imd:
+            inst.Target = uint16(inst.Bytes[2])
+            inst.HasTarget = true
+    }
+    if inst.HasTarget {
+        inst.Symbol, _ = c.Symbols.Name(inst.Target)
+    } else if desc.AddrMode == Imw {
+        // usually an address being loaded into X or SP
+        inst.Symbol, _ = c.Symbols.Name(inst.Operand)
+    }
+    return inst
+}
+
+// Bytes the instruction takes up, 0 if it couldn't be read
+func (i Instruction) Len() uint16 {
+    if !i.Legal && len(i.Bytes) > 0 {
+        return 1
+    }
+    return uint16(len(i.Bytes))
+}
+
+// The one-line disassembly, as Disasm shows it
+func (i Instruction) String() string {
+    if !i.Legal {
+        return fmt.Sprintf("0x%.4X    --  ILL", i.PC)
+    }
+    var instbytes string
+    for _, b := range i.Bytes {
+        instbytes += fmt.Sprintf("%.2X", b)
+    }
+    desc := fmt.Sprintf("%-5s ", i.Mnemonic)
+    switch i.Mode {
+        case Rel:  // relative
+            offset := int8(i.Bytes[1])
+            desc += i.address(i.Target, "$%04X")
+            if offset < 0 {
+                desc += " ("+ fmt.Sprintf("$%04X+2 - %d", i.PC, -offset) +")"
+            } else {
+                desc += " ("+ fmt.Sprintf("$%04X+2 + %d", i.PC, offset) +")"
+            }
+
+        case Imb:  // byte immediate
+            desc += fmt.Sprintf("0x%02X", i.Operand)
+
+        case Imw:  // word immediate
+            desc += i.address(i.Operand, "$%04X")
+
+        case Idx:  // X + byte offset
+            desc += fmt.Sprintf("(x+0x%02X)", i.Operand)
+
+        case Imx:  // HD63701YO: immediate, X + byte offset
+            desc += fmt.Sprintf("0x%02X,(x+0x%02X)", i.Bytes[1], i.Bytes[2])
+
+        case Dir:  // direct (aka zero-page)
+            desc += i.address(i.Operand, "0x%02X")
+
+        case Imd:  // HD63701YO: immediate, direct address
+            desc += fmt.Sprintf("0x%02X,", i.Bytes[1]) + i.address(i.Target, "0x%02X")
+
+        case Ext:  // extended
+            desc += i.address(i.Operand, "$%04X")
+
+        case Sx1:  // HD63701YO, undocumented: byte from (s+1)
+            desc += "(s+1)"
+
+        case Inh:  // no params
+    }
+    return fmt.Sprintf("0x%.4X    %-8s  %s", i.PC, instbytes, desc)
+}
+
+// the symbol if there is one, otherwise the number
+func (i Instruction) address(addr uint16, format string) string {
+    if i.Symbol != "" {
+        return i.Symbol
+    }
+    return fmt.Sprintf(format, addr)
+}
@@ -0,0 +1,33 @@
+package m6800
+
+import (
+    "reflect"
+    "testing"
+)
+
+func TestDecode(t *testing.T) {
+    tests := []struct {
+        variant  Variant
+        code     []uint8
+        want     Instruction
+    }{
+        {MC6800, []uint8{0x26, 0xFB}, Instruction{Opcode:0x26, Mnemonic:"bne", Mode:Rel, Bytes:[]uint8{0x26, 0xFB}, Operand:0xFB, Target:0x0FFD, HasTarget:true, Cycles:4, Legal:true}},
+        {MC6800, []uint8{0xBD, 0xF8, 0x1E}, Instruction{Opcode:0xBD, Mnemonic:"jsr", Mode:Ext, Bytes:[]uint8{0xBD, 0xF8, 0x1E}, Operand:0xF81E, Target:0xF81E, HasTarget:true, Cycles:9, Legal:true}},
+        {MC6800, []uint8{0xAB, 0x10}, Instruction{Opcode:0xAB, Mnemonic:"adda", Mode:Idx, Bytes:[]uint8{0xAB, 0x10}, Operand:0x10, Cycles:5, Flags:"HNZVC", Legal:true}},
+        {MC6800, []uint8{0x8C, 0x12, 0x34}, Instruction{Opcode:0x8C, Mnemonic:"cmpx", Mode:Imw, Bytes:[]uint8{0x8C, 0x12, 0x34}, Operand:0x1234, Cycles:3, Flags:"NZV", Legal:true}},
+        {MC6801, []uint8{0x8C, 0x12, 0x34}, Instruction{Opcode:0x8C, Mnemonic:"cmpx", Mode:Imw, Bytes:[]uint8{0x8C, 0x12, 0x34}, Operand:0x1234, Cycles:4, Flags:"NZVC", Legal:true}},
+        {HD6301, []uint8{0x71, 0xFE, 0x40}, Instruction{Opcode:0x71, Mnemonic:"aim", Mode:Imd, Bytes:[]uint8{0x71, 0xFE, 0x40}, Operand:0xFE40, Target:0x0040, HasTarget:true, Cycles:6, Flags:"NZV", Legal:true}},
+        {MC6800, []uint8{0x02}, Instruction{Opcode:0x02, Mnemonic:"ill", Bytes:[]uint8{0x02}}},
+    }
+    for _, tt := range tests {
+        mmu := &vecmem{bytes:map[uint16]uint8{}, fill:func(uint16) uint8 { return 0 }}
+        for i, b := range tt.code {
+            mmu.bytes[0x1000 + uint16(i)] = b
+        }
+        tt.want.PC = 0x1000
+        m := &M6800{Variant:tt.variant}
+        if got := m.Decode(0x1000, mmu); !reflect.DeepEqual(got, tt.want) {
+            t.Errorf("%s % X\n     got %+v\n    want %+v", tt.variant, tt.code, got, tt.want)
+        }
+    }
+}
@@ -0,0 +1,60 @@
+package m6800
+
+import (
+    "fmt"
+)
+
+// Step returns one of these when the CPU can't continue, and leaves the CPU
+// halted with PC pointing at the offending opcode.  CPU is the register state
+// as it was just before that opcode was fetched.
+
+// Opcode is invalid for the selected CPU
+type ErrIllegalOpcode struct {
+    PC      uint16
+    Opcode  uint8
+    CPU     Registers
+}
+
+func (e ErrIllegalOpcode) Error() string {
+    return fmt.Sprintf("illegal opcode %.2X at $%.4X ; %s", e.Opcode, e.PC, e.CPU.Status())
+}
+
+// Opcode is valid but the emulator doesn't implement it
+type ErrUnimplemented struct {
+    PC      uint16
+    Opcode  uint8
+    CPU     Registers
+}
+
+func (e ErrUnimplemented) Error() string {
+    return fmt.Sprintf("unimplemented opcode %.2X at $%.4X ; %s", e.Opcode, e.PC, e.CPU.Status())
+}
+
+// The MMU refused a read or write while executing the opcode
+type BusFault struct {
+    Addr    uint16
+    Write   bool
+    PC      uint16
+    Opcode  uint8
+    CPU     Registers
+}
+
+func (e BusFault) Error() string {
+    access := "read"
+    if e.Write {
+        access = "write"
+    }
+    return fmt.Sprintf("bus fault on %s of $%.4X by opcode %.2X at $%.4X ; %s", access, e.Addr, e.Opcode, e.PC, e.CPU.Status())
+}
+
+// HCF (an undocumented opcode) ran, the real part spins on the address bus
+// until it's reset
+type ErrHCF struct {
+    PC      uint16
+    Opcode  uint8
+    CPU     Registers
+}
+
+func (e ErrHCF) Error() string {
+    return fmt.Sprintf("HCF (%.2X) at $%.4X, halted until reset ; %s", e.Opcode, e.PC, e.CPU.Status())
+}
@@ -0,0 +1,208 @@
+//go:build go1.18
+// +build go1.18
+
+package m6800
+
+import (
+    "testing"
+)
+
+// A second, deliberately different, model of the accumulator ALU ops.  The
+// implementation works out flags from sign bits, this works them out from
+// wide arithmetic and the tables in the Programming Manual, so they should
+// only agree if both are right.
+//
+//     go test -run XXX -fuzz FuzzALU ./cpu/m6800
+
+type refresult struct {
+    acc    uint8
+    cc     uint8
+    mask   uint8   // flags that are defined, the rest aren't compared
+}
+
+func refflags(cc uint8, h, n, z, v, c bool) uint8 {
+    for _, f := range []struct{ bit uint8; set bool }{{H, h}, {N, n}, {Z, z}, {V, v}, {C, c}} {
+        if f.set {
+            cc |= f.bit
+        } else {
+            cc &= ^f.bit
+        }
+    }
+    return cc
+}
+
+func refadd(acc, m uint8, cc uint8, carry bool) refresult {
+    cin := 0
+    if carry && cc & C == C {
+        cin = 1
+    }
+    wide := int(acc) + int(m) + cin
+    signed := int(int8(acc)) + int(int8(m)) + cin
+    half := int(acc & 0x0F) + int(m & 0x0F) + cin > 0x0F
+    r := uint8(wide)
+    return refresult{r, refflags(cc, half, r >= 0x80, r == 0, signed < -128 || signed > 127, wide > 0xFF), H|N|Z|V|C}
+}
+
+func refsub(acc, m uint8, cc uint8, carry bool) refresult {
+    bin := 0
+    if carry && cc & C == C {
+        bin = 1
+    }
+    wide := int(acc) - int(m) - bin
+    signed := int(int8(acc)) - int(int8(m)) - bin
+    r := uint8(wide)
+    return refresult{r, refflags(cc, cc & H == H, r >= 0x80, r == 0, signed < -128 || signed > 127, wide < 0), N|Z|V|C}
+}
+
+// V is N^C after the shift, for all the shifts and rotates (A-11, A-51, A-58)
+func refshift(r uint8, cc uint8, c bool) refresult {
+    n := r >= 0x80
+    return refresult{r, refflags(cc, cc & H == H, n, r == 0, n != c, c), N|Z|V|C}
+}
+
+// everything but the carry-in comes from the unary op itself
+func refunary(op uint8, acc uint8, cc uint8) refresult {
+    cin := cc & C == C
+    keep := cc & H == H
+    switch op & 0x0F {
+        case 0x0:  // NEG, C is the borrow from 0 - acc
+            return refsub(0, acc, cc, false)
+        case 0x3:  // COM
+            r := ^acc
+            return refresult{r, refflags(cc, keep, r >= 0x80, r == 0, false, true), N|Z|V|C}
+        case 0x4:  // LSR
+            return refshift(acc >> 1, cc, acc & 0x01 == 0x01)
+        case 0x6:  // ROR
+            r := acc >> 1
+            if cin {
+                r |= 0x80
+            }
+            return refshift(r, cc, acc & 0x01 == 0x01)
+        case 0x7:  // ASR
+            return refshift(uint8(int8(acc) >> 1), cc, acc & 0x01 == 0x01)
+        case 0x8:  // ASL
+            return refshift(acc << 1, cc, acc & 0x80 == 0x80)
+        case 0x9:  // ROL
+            r := acc << 1
+            if cin {
+                r |= 0x01
+            }
+            return refshift(r, cc, acc & 0x80 == 0x80)
+        case 0xA:  // DEC, C untouched
+            r := acc - 1
+            return refresult{r, refflags(cc, keep, r >= 0x80, r == 0, acc == 0x80, cin), N|Z|V|C}
+        case 0xC:  // INC, C untouched
+            r := acc + 1
+            return refresult{r, refflags(cc, keep, r >= 0x80, r == 0, acc == 0x7F, cin), N|Z|V|C}
+        case 0xD:  // TST
+            return refresult{acc, refflags(cc, keep, acc >= 0x80, acc == 0, false, false), N|Z|V|C}
+        case 0xF:  // CLR
+            return refresult{0, refflags(cc, keep, false, true, false, false), N|Z|V|C}
+    }
+    panic("not a unary op")
+}
+
+// DAA straight from the table on A-34, the combinations it doesn't list
+// aren't BCD and the result is undefined, ok is false for those
+func refdaa(acc uint8, cc uint8) (refresult, bool) {
+    hi, lo := acc >> 4, acc & 0x0F
+    c, h := cc & C == C, cc & H == H
+    var add uint8
+    var cout bool
+    switch {
+        case !c && hi <= 9 && !h && lo <= 9:  add, cout = 0x00, false
+        case !c && hi <= 8 && !h && lo >= 10: add, cout = 0x06, false
+        case !c && hi <= 9 && h && lo <= 3:   add, cout = 0x06, false
+        case !c && hi >= 10 && !h && lo <= 9: add, cout = 0x60, true
+        case !c && hi >= 9 && !h && lo >= 10: add, cout = 0x66, true
+        case !c && hi >= 10 && h && lo <= 3:  add, cout = 0x66, true
+        case c && hi <= 2 && !h && lo <= 9:   add, cout = 0x60, true
+        case c && hi <= 2 && !h && lo >= 10:  add, cout = 0x66, true
+        case c && hi <= 3 && h && lo <= 3:    add, cout = 0x66, true
+        default:
+            return refresult{}, false
+    }
+    r := acc + add
+    // V is undefined
+    return refresult{r, refflags(cc, h, r >= 0x80, r == 0, false, cout), N|Z|C}, true
+}
+
+// the opcodes the reference knows, fuzz input picks one by index
+var refops = []uint8{
+    0x10, 0x11, 0x19, 0x1B,
+    0x40, 0x43, 0x44, 0x46, 0x47, 0x48, 0x49, 0x4A, 0x4C, 0x4D, 0x4F,
+    0x50, 0x53, 0x54, 0x56, 0x57, 0x58, 0x59, 0x5A, 0x5C, 0x5D, 0x5F,
+    0x80, 0x81, 0x82, 0x89, 0x8B,
+    0xC0, 0xC1, 0xC2, 0xC9, 0xCB,
+}
+
+// returns the expected A and B, and the CC flags to compare
+func refstep(op, operand, a, b, cc uint8) (uint8, uint8, refresult, bool) {
+    switch {
+        case op == 0x10:  // SBA
+            r := refsub(a, b, cc, false)
+            return r.acc, b, r, true
+        case op == 0x11:  // CBA
+            r := refsub(a, b, cc, false)
+            return a, b, r, true
+        case op == 0x19:
+            r, ok := refdaa(a, cc)
+            return r.acc, b, r, ok
+        case op == 0x1B:  // ABA
+            r := refadd(a, b, cc, false)
+            return r.acc, b, r, true
+        case op & 0xF0 == 0x40:
+            r := refunary(op, a, cc)
+            return r.acc, b, r, true
+        case op & 0xF0 == 0x50:
+            r := refunary(op, b, cc)
+            return a, r.acc, r, true
+    }
+    // accumulator immediate, $8x for A and $Cx for B
+    acc := a
+    if op & 0xF0 == 0xC0 {
+        acc = b
+    }
+    var r refresult
+    switch op & 0x0F {
+        case 0x0: r = refsub(acc, operand, cc, false)
+        case 0x1: r = refsub(acc, operand, cc, false)
+        case 0x2: r = refsub(acc, operand, cc, true)
+        case 0x9: r = refadd(acc, operand, cc, true)
+        case 0xB: r = refadd(acc, operand, cc, false)
+    }
+    if op & 0x0F == 0x1 {
+        r.acc = acc  // CMP
+    }
+    if op & 0xF0 == 0xC0 {
+        return a, r.acc, r, true
+    }
+    return r.acc, b, r, true
+}
+
+func FuzzALU(f *testing.F) {
+    for i := range refops {
+        for _, v := range []uint8{0x00, 0x01, 0x0F, 0x7F, 0x80, 0x99, 0xFF} {
+            f.Add(uint8(i), v, v, ^v, uint8(0x00))
+            f.Add(uint8(i), ^v, v, v, uint8(0x3F))
+        }
+    }
+    f.Fuzz(func(t *testing.T, index, operand, a, b, cc uint8) {
+        op := refops[int(index) % len(refops)]
+        cc &= 0x3F
+        wanta, wantb, want, ok := refstep(op, operand, a, b, cc)
+        if !ok {
+            t.Skip()
+        }
+
+        mmu := &vecmem{bytes:map[uint16]uint8{0x1000:op, 0x1001:operand}, fill:func(uint16) uint8 { return 0 }}
+        m := &M6800{Registers:Registers{PC:0x1000, A:a, B:b, CC:cc}}
+        if _, err := run_vector(m, mmu); err != nil {
+            t.Fatal(err)
+        }
+        if m.A != wanta || m.B != wantb || m.CC & want.mask != want.cc & want.mask {
+            t.Fatalf("%s #0x%.2X with A:0x%.2X B:0x%.2X CC:%06b\n     got A:0x%.2X B:0x%.2X CC:%06b\n    want A:0x%.2X B:0x%.2X CC:%06b (mask %06b)",
+                M6800Ops[op].Mnemonic, operand, a, b, cc, m.A, m.B, m.CC, wanta, wantb, want.cc, want.mask)
+        }
+    })
+}
@@ -0,0 +1,172 @@
+package m6800
+
+import (
+    "github.com/bartgrantham/fpemu/mem"
+)
+
+// Hitachi HD6301/HD63701 additions to the 6801 instruction set
+// page references are to the HD6301V1 datasheet, "Table 3 CPU Instruction Set"
+// the 6301 is a CMOS 6801 with faster timings, bit manipulation ops, and a
+// TRAP vector ($FFEE) that is taken on an illegal opcode instead of halting
+
+// HD6301V1 datasheet table 3
+var cyclecounts_6301 [256]int = [256]int{
+//  00  01  02  03  04  05  06  07  08  09  0A  0B  0C  0D  0E  0F
+    0,  1,  0,  0,  1,  1,  1,  1,  1,  1,  1,  1,  1,  1,  1,  1,  // 00
+    1,  1,  3,  3,  0,  0,  1,  1,  2,  2,  4,  1,  0,  0,  0,  0,  // 10
+    3,  3,  3,  3,  3,  3,  3,  3,  3,  3,  3,  3,  3,  3,  3,  3,  // 20
+    1,  1,  3,  3,  1,  1,  4,  4,  4,  5,  1,  10, 5,  7,  9,  12, // 30
+    1,  0,  0,  1,  1,  0,  1,  1,  1,  1,  1,  0,  1,  1,  0,  1,  // 40
+    1,  0,  0,  1,  1,  0,  1,  1,  1,  1,  1,  0,  1,  1,  0,  1,  // 50
+    6,  7,  7,  6,  6,  7,  6,  6,  6,  6,  6,  5,  6,  4,  3,  5,  // 60
+    6,  6,  6,  6,  6,  6,  6,  6,  6,  6,  6,  4,  6,  4,  3,  5,  // 70
+    2,  2,  2,  3,  2,  2,  2,  0,  2,  2,  2,  2,  3,  5,  3,  0,  // 80
+    3,  3,  3,  4,  3,  3,  3,  3,  3,  3,  3,  3,  4,  5,  4,  4,  // 90
+    4,  4,  4,  5,  4,  4,  4,  4,  4,  4,  4,  4,  5,  5,  5,  5,  // A0
+    4,  4,  4,  5,  4,  4,  4,  4,  4,  4,  4,  4,  5,  6,  5,  5,  // B0
+    2,  2,  2,  3,  2,  2,  2,  0,  2,  2,  2,  2,  3,  0,  3,  0,  // C0
+    3,  3,  3,  4,  3,  3,  3,  3,  3,  3,  3,  3,  4,  4,  4,  4,  // D0
+    4,  4,  4,  5,  4,  4,  4,  4,  4,  4,  4,  4,  5,  5,  5,  5,  // E0
+    4,  4,  4,  5,  4,  4,  4,  4,  4,  4,  4,  4,  5,  5,  5,  5,  // F0
+}
+
+var dispatch_6301 [256]func(*M6800, mem.MMU16)
+
+// opcodes the 6301 adds to the 6801
+var ops_6301 = map[uint8]func(*M6800, mem.MMU16){
+    0x12:ASX_12, 0x13:ASX_13, 0x18:XGDX_18, 0x1A:SLP_1A,
+    0x61:AIM_61, 0x62:OIM_62, 0x65:EIM_65, 0x6B:TIM_6B,
+    0x71:AIM_71, 0x72:OIM_72, 0x75:EIM_75, 0x7B:TIM_7B,
+}
+
+func init() {
+    dispatch_6301 = dispatch_table
+    for opcode, f := range ops_6801 {
+        dispatch_6301[opcode] = f
+    }
+    for opcode, f := range ops_6301 {
+        dispatch_6301[opcode] = f
+    }
+    // everything without a timing is illegal, and traps
+    for opcode := range dispatch_6301 {
+        if cyclecounts_6301[opcode] == 0 {
+            dispatch_6301[opcode] = TRAP
+            cyclecounts_6301[opcode] = 12
+        }
+    }
+}
+
+// Illegal opcode on the 6301, stacks the registers and vectors through $FFEE
+// the stacked PC points at the illegal opcode
+func TRAP(m *M6800, mmu mem.MMU16) {
+    m.PC -= 1
+    m.save_registers(mmu)
+    m.CC |= I
+    m.PC = mmu.R16(0xFFEE)
+}
+
+// Add byte at SP+1 to X, undocumented, no flags
+func ASX_12(m *M6800, mmu mem.MMU16) {
+    m.X += uint16(mmu.R8(m.SP+1))
+}
+
+// Add byte at SP+1 to X, undocumented duplicate of $12, no flags
+func ASX_13(m *M6800, mmu mem.MMU16) {
+    m.X += uint16(mmu.R8(m.SP+1))
+}
+
+// Exchange D and X, no flags
+func XGDX_18(m *M6800, mmu mem.MMU16) {
+    d := m.D()
+    m.SetD(m.X)
+    m.X = d
+}
+
+// Sleep until an interrupt, like WAI but nothing is stacked, no flags
+func SLP_1A(m *M6800, mmu mem.MMU16) {
+    m.Sleeping = true
+}
+
+// And IMM into IND, flags:NZV
+func AIM_61(m *M6800, mmu mem.MMU16) {
+    imm := mmu.R8(m.PC)
+    addr := m.X + uint16(mmu.R8(m.PC+1))
+    tmp := mmu.R8(addr) & imm
+    m.CC &= ^V
+    m.set_NZ8(tmp)
+    mmu.W8(addr, tmp)
+    m.PC += 2
+}
+
+// OR IMM into IND, flags:NZV
+func OIM_62(m *M6800, mmu mem.MMU16) {
+    imm := mmu.R8(m.PC)
+    addr := m.X + uint16(mmu.R8(m.PC+1))
+    tmp := mmu.R8(addr) | imm
+    m.CC &= ^V
+    m.set_NZ8(tmp)
+    mmu.W8(addr, tmp)
+    m.PC += 2
+}
+
+// Exclusive or IMM into IND, flags:NZV
+func EIM_65(m *M6800, mmu mem.MMU16) {
+    imm := mmu.R8(m.PC)
+    addr := m.X + uint16(mmu.R8(m.PC+1))
+    tmp := mmu.R8(addr) ^ imm
+    m.CC &= ^V
+    m.set_NZ8(tmp)
+    mmu.W8(addr, tmp)
+    m.PC += 2
+}
+
+// Test IMM against IND, flags:NZV
+func TIM_6B(m *M6800, mmu mem.MMU16) {
+    imm := mmu.R8(m.PC)
+    addr := m.X + uint16(mmu.R8(m.PC+1))
+    m.CC &= ^V
+    m.set_NZ8(mmu.R8(addr) & imm)
+    m.PC += 2
+}
+
+// And IMM into DIR, flags:NZV
+func AIM_71(m *M6800, mmu mem.MMU16) {
+    imm := mmu.R8(m.PC)
+    addr := uint16(mmu.R8(m.PC+1))
+    tmp := mmu.R8(addr) & imm
+    m.CC &= ^V
+    m.set_NZ8(tmp)
+    mmu.W8(addr, tmp)
+    m.PC += 2
+}
+
+// OR IMM into DIR, flags:NZV
+func OIM_72(m *M6800, mmu mem.MMU16) {
+    imm := mmu.R8(m.PC)
+    addr := uint16(mmu.R8(m.PC+1))
+    tmp := mmu.R8(addr) | imm
+    m.CC &= ^V
+    m.set_NZ8(tmp)
+    mmu.W8(addr, tmp)
+    m.PC += 2
+}
+
+// Exclusive or IMM into DIR, flags:NZV
+func EIM_75(m *M6800, mmu mem.MMU16) {
+    imm := mmu.R8(m.PC)
+    addr := uint16(mmu.R8(m.PC+1))
+    tmp := mmu.R8(addr) ^ imm
+    m.CC &= ^V
+    m.set_NZ8(tmp)
+    mmu.W8(addr, tmp)
+    m.PC += 2
+}
+
+// Test IMM against DIR, flags:NZV
+func TIM_7B(m *M6800, mmu mem.MMU16) {
+    imm := mmu.R8(m.PC)
+    addr := uint16(mmu.R8(m.PC+1))
+    m.CC &= ^V
+    m.set_NZ8(mmu.R8(addr) & imm)
+    m.PC += 2
+}
@@ -1,44 +1,60 @@
 package m6800
 
 import (
+    "encoding/binary"
     "fmt"
-    "log"
-    "os"
+    "io"
     "time"
 
+    "github.com/bartgrantham/fpemu/cpu"
     "github.com/bartgrantham/fpemu/mem"
     "github.com/bartgrantham/fpemu/pia"
     "github.com/bartgrantham/fpemu/pia/m6821"
-    "github.com/bartgrantham/fpemu/ui"
-
-    "github.com/gdamore/tcell"
 )
 
-var crystal float32 = 3580000.0 / 4
-
-var trace  *os.File
-var wavout *os.File
-
-var Scr tcell.Screen
-
-func init() {
-//   trace, _ = os.OpenFile("trace.log", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0755)
-//   wavout, _ = os.OpenFile("out.f32", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0755)
-}
-
-type M6800 struct {
+type Registers struct {
     PC      uint16
     X       uint16
     A       uint8
     B       uint8
     CC      uint8
     SP      uint16
+}
+
+type M6800 struct {
+    Registers
+    Variant Variant  // instruction set and timing, MC6800 by default
+    Undocumented bool  // MC6800 only, run the undocumented opcodes listed in undocumented.go instead of faulting
     PIA     pia.PIA
-    NMI     bool
+    Waiting bool   // WAI executed, registers already stacked
+    Sleeping bool  // SLP executed, nothing stacked
+    Fault   error  // why the CPU halted, Step does nothing while this is set
+
+    Clock   Clock            // crystal and divider, PinballClock by default
+    Trace   io.Writer        // per-instruction disassembly, nil disables
+    WavOut  io.Writer        // raw little-endian float32 samples from Callback, nil disables
+    Logger  func(string)     // status messages from Callback, nil discards
+    Debug   bool             // keep the lookback for History(), and Exec single-steps
+    Symbols *Symbols         // names used in the disassembly, nil for none
+
+    // interrupt outputs of devices wired to the CPU, polled every Step and
+    // ORed with whatever IRQ() and NMI() last drove
+    IRQLines []func() bool
+    NMILines []func() bool
+
+    lookback [16]Registers
+    lbindex  int
+    op       uint8           // opcode being dispatched
+    bus      bus             // stamps each access with its cycle
+    cache    *blockcache     // decoded blocks for Exec, nil until it's first called
+    irq      bool            // interrupt lines, as driven by IRQ() and NMI()
+    nmi      bool
+    nmiprev  bool            // NMI level at the last Step, for edge detection
+    nmilatch bool            // NMI edge seen and not yet serviced
+    cycles   uint64
 }
 
-var lookback [16]M6800
-var lbindex int
+var _ cpu.CPU16 = (*M6800)(nil)
 
 // flags: --HI NZVC
 //        8421 8421
@@ -53,58 +69,133 @@ const (
 
 func NewM6800(mmu mem.MMU16, pia pia.PIA) *M6800{
     // On firepower port A is the DAC, port B is from the mainboard
-    m := M6800{PC:mmu.R16(0xFFFE), PIA:pia}
-//    m.SEI_0F(mmu)  // CPU starts with interrupts disabled/masked
+    m := M6800{PIA:pia, Clock:PinballClock, Symbols:BuiltinSymbols()}
+    m.IRQLines = append(m.IRQLines, func() bool { return pia.IRQ(0) || pia.IRQ(1) })
+    m.Reset(mmu)
     return &m
 }
 
-func (m *M6800) Status() string {
+func (m *M6800) Name() string {
+    return m.Variant.String()
+}
+
+// Load PC from the reset vector, CPU starts with interrupts disabled/masked
+func (m *M6800) Reset(mmu mem.MMU16) {
+    m.Waiting = false
+    m.Sleeping = false
+    m.Fault = nil
+    m.nmilatch = false
+    m.Invalidate()
+    m.PC = mmu.R16(0xFFFE)
+    SEI_0F(m, mmu)
+}
+
+// IRQ is level-sensitive, it's taken at an instruction boundary for as long as
+// it's asserted and I is clear
+func (m *M6800) IRQ(assert bool) {
+    m.irq = assert
+}
+
+// NMI is edge-triggered, asserting it latches an interrupt that's taken at the
+// next instruction boundary regardless of I, even if it's released before then
+func (m *M6800) NMI(assert bool) {
+    if assert && !m.nmi {
+        m.nmilatch = true
+    }
+    m.nmi = assert
+}
+
+func poll(lines []func() bool) bool {
+    for _, line := range lines {
+        if line() {
+            return true
+        }
+    }
+    return false
+}
+
+func (m *M6800) Regs() []cpu.Register {
+    return []cpu.Register{
+        {Name:"PC", Bits:16},
+        {Name:"SP", Bits:16},
+        {Name:"X",  Bits:16},
+        {Name:"A",  Bits:8},
+        {Name:"B",  Bits:8},
+        {Name:"CC", Bits:8, Flags:"--HINZVC"},
+    }
+}
+
+func (m *M6800) Reg(name string) uint16 {
+    switch name {
+        case "PC": return m.PC
+        case "SP": return m.SP
+        case "X":  return m.X
+        case "A":  return uint16(m.A)
+        case "B":  return uint16(m.B)
+        case "CC": return uint16(m.CC)
+    }
+    return 0
+}
+
+func (m *M6800) SetReg(name string, val uint16) {
+    switch name {
+        case "PC": m.PC = val
+        case "SP": m.SP = val
+        case "X":  m.X = val
+        case "A":  m.A = uint8(val)
+        case "B":  m.B = uint8(val)
+        case "CC": m.CC = uint8(val) & 0x3F
+    }
+}
+
+func (m *M6800) Cycles() uint64 {
+    return m.cycles
+}
+
+func (m *M6800) Halted() error {
+    return m.Fault
+}
+
+func (m *Registers) Status() string {
     fmtstr := "PC: $%.4X ($%.4X) ; X:$%.4X ; A:0x%.2X ; B:0x%.2X ; CC:0x%08b ; SP:$%.4X"
     return fmt.Sprintf(fmtstr, m.PC, m.PC, m.X, m.A, m.B, m.CC, m.SP)
 }
 
-var logging bool //= true
-func (m *M6800) Step(mmu mem.MMU16) (int, error) {
+func (m *M6800) Step(mmu mem.MMU16) (count int, err error) {
     var out string
-    // CPU state trace
+    var opcode uint8
+    if m.Fault != nil {
+        return 0, m.Fault
+    }
+    snapshot := m.Registers
+    // an MMU panics with mem.AccessError on a bad address, turn that into a BusFault
     defer func() {
         if r := recover(); r != nil {
-            Scr.Fini()
-            for i:=0; i<len(lookback); i++ {
-                j := (lbindex+i) % len(lookback)
-                cpu := lookback[j]
-                out, _ = (&cpu).Disasm(cpu.PC, mmu)
-                fmt.Printf("%s %s\n", cpu.Status(), out)
+            fault, ok := r.(mem.AccessError)
+            if !ok {
+                panic(r)
             }
-            for index:=0; index<0x80; index+=0x20 {
-                out = "    "
-                for offset:=0; offset<0x20; offset++ {
-                    val := mmu.R8(uint16(index+offset))
-                    out += fmt.Sprintf("%.2x ", val)
-                    if offset == 0x0f {
-                        out += "  "
-                    }
-                }
-                fmt.Println(out)
-            }
-            panic(r)
+            m.Registers = snapshot
+            m.Fault = BusFault{Addr:fault.Addr, Write:fault.Write, PC:m.PC, Opcode:opcode, CPU:snapshot}
+            count, err = 0, m.Fault
         }
     }()
-    if (m.PIA.IRQ(0) || m.PIA.IRQ(1)) && (m.CC & I != I) {
-        m.save_registers(mmu)
-        SEI_0F(m, mmu)  // interrupts masked
-        if m.NMI {
-            m.PC = mmu.R16(0xFFFC)
-        } else {
-            m.PC = mmu.R16(0xFFF8)
-        }
+    if n, idle := m.service(mmu); idle {
+        return n, nil
+    }
+    snapshot = m.Registers
+    if m.Debug {
+        m.lookback[m.lbindex] = m.Registers
+        m.lbindex = (m.lbindex+1) % len(m.lookback)
     }
-    lookback[lbindex] = *m
-    lbindex = (lbindex+1) % len(lookback)
 
-    opcode := mmu.R8(m.PC)
+    // the opcode fetch is the first cycle of every instruction
+    if clk, ok := mmu.(mem.Clocked); ok {
+        clk.SetCycle(m.cycles)
+    }
+    opcode = mmu.R8(m.PC)
 
-    if logging {
+    if m.Trace != nil {
         //out = fmt.Sprintf("%.2X  %s\n", opcode, m.Status())
         out, _ = m.Disasm(m.PC, mmu)
         out += "\n" + mmu.String()
@@ -118,14 +209,93 @@ func (m *M6800) Step(mmu mem.MMU16) (int, error) {
             out += "\n"
         }
 */
-        fmt.Fprintln(trace, out)
+        fmt.Fprintln(m.Trace, out)
     }
 
     m.PC += 1
-    count, err := m.dispatch(opcode, mmu)
+    count, err = m.dispatch(opcode, mmu)
+    m.cycles += uint64(count)
     return count, err
 }
 
+// Sample the interrupt lines at an instruction boundary and take one if it's
+// due, idle is true if there's no instruction to execute this time, either an
+// interrupt was taken or the CPU is parked in WAI/SLP
+func (m *M6800) service(mmu mem.MMU16) (count int, idle bool) {
+    irq, due := m.sample()
+    if due {
+        return m.interrupt(mmu), true
+    }
+    if m.Sleeping && irq {
+        // a masked IRQ still ends SLP, execution continues after it
+        m.Sleeping = false
+    }
+    if m.Waiting || m.Sleeping {
+        // WAI/SLP hold the bus idle until an interrupt arrives
+        m.cycles += 1
+        return 1, true
+    }
+    return 0, false
+}
+
+// Latch an NMI edge and read the IRQ level, due is true if an interrupt would
+// be taken at this boundary
+func (m *M6800) sample() (irq, due bool) {
+    nmi := m.nmi || poll(m.NMILines)
+    if nmi && !m.nmiprev {
+        m.nmilatch = true
+    }
+    m.nmiprev = nmi
+    irq = m.irq || poll(m.IRQLines)
+    return irq, m.nmilatch || (irq && m.CC & I != I)
+}
+
+// In WAI or SLP, Step only burns a cycle at a time until an interrupt arrives
+func (m *M6800) parked() bool {
+    return m.Waiting || m.Sleeping
+}
+
+// Stack the registers and vector to the NMI or IRQ handler, NMI has priority
+// entry takes 12 cycles, or 3 out of WAI since the registers are already stacked
+func (m *M6800) interrupt(mmu mem.MMU16) int {
+    count := 12
+    if m.Waiting {
+        count = 3
+    }
+    m.bus.begin(mmu, m.cycles, count)
+    if !m.Waiting {
+        m.save_registers(&m.bus)
+    }
+    m.Waiting = false
+    m.Sleeping = false
+    SEI_0F(m, mmu)  // interrupts masked
+    if m.nmilatch {
+        m.nmilatch = false
+        m.PC = m.bus.R16(0xFFFC)
+    } else {
+        m.PC = m.bus.R16(0xFFF8)
+    }
+    m.bus.flush()
+    m.cycles += uint64(count)
+    return count
+}
+
+// Disassembly of the last few instructions executed, oldest first
+// only kept with Debug set
+func (m *M6800) History(mmu mem.MMU16) []string {
+    var lines []string
+    if !m.Debug {
+        return nil
+    }
+    for i:=0; i<len(m.lookback); i++ {
+        j := (m.lbindex+i) % len(m.lookback)
+        regs := m.lookback[j]
+        out, _ := m.Disasm(regs.PC, mmu)
+        lines = append(lines, regs.Status() + " " + out)
+    }
+    return lines
+}
+
 /*
 * When RTI is executed the saved registers are restored and processing proceeds from the interrupted point
 * On IRQ:
@@ -134,7 +304,7 @@ func (m *M6800) Step(mmu mem.MMU16) (int, error) {
     * I is set to 1 (IRQs masked)
     * 16-bit (big endian) irq vector is loaded from $FFF8 and the irq begins processing
 * On NMI:
-    * If the NMI line goes low for at least one ϕ2 cycle
+    * If the NMI line goes low (an edge, it is latched), regardless of I
     * registers CC, B, A, X, PC (7 bytes, in that order, big endian for X and PC) are stored at SP-6..SP
     * I is set to 1 (IRQs masked)
     * 16-bit (big endian) irq vector is loaded from $FFFC and the irq begins processing
@@ -146,36 +316,52 @@ func (m *M6800) Step(mmu mem.MMU16) (int, error) {
 On firepower port A is the DAC, port B is from the mainboard
 */
 
-func (m *M6800) Callback(mmu mem.MMU16, ctrl chan uint8, pia *m6821.M6821) func([]float32) {
+// Run the CPU in step with the host's audio, port is where the sound commands
+// from ctrl are written, as the board wires them
+func (m *M6800) Callback(mmu mem.MMU16, ctrl chan uint8, pia *m6821.M6821, port uint16) func([]float32) {
     var code uint8
-    // this calculation is suspect
-    hostrate := float32(44100)
-    cycles_per_sample := crystal / hostrate
-    log.Printf("crystal %.8f, cps %.8f\n", crystal, cycles_per_sample)
-    var jitter, samp float32
+    hostrate := uint64(44100)
+    pace := m.Clock.pacer(hostrate)
+    var jitter int
+    var samp float32
     var i, total_cycles int
+    // DAC and CVSD changes are placed on their own cycle, not the sample's
+    pia.Timed = true
     return func(out []float32) {
         total_cycles = 0
         start := time.Now()
         for i=0; i<len(out); i++ {
             select {
                 case code = <-ctrl:
-                    m.PIA.Write(1, code^0xFF)
+                    m.PIA.Write(port, code)
                 default:
             }
             for jitter < 0 {
-                cycles, _ := m.Step(mmu)
-                jitter += float32(cycles)
+                cycles, err := m.Exec(mmu, -jitter)
+                if err != nil {
+                    // halted, hold the DAC where it is
+                    jitter = 0
+                    break
+                }
+                jitter += cycles
                 total_cycles += cycles
+                if m.parked() && jitter < 0 {
+                    // Step has sampled the interrupt lines and nothing woke
+                    // the CPU, nothing else can before the next sample
+                    m.cycles += uint64(-jitter)
+                    total_cycles += -jitter
+                    jitter = 0
+                }
             }
-            samp = (float32(pia.ORA) / 256) - .5
+            // jitter is how far the last instruction ran past this sample
+            dac := pia.Output(m.cycles - uint64(jitter))
+            samp = (float32(dac) / 256) - .5
             samp += pia.CVSD.State * 2
             out[i] = samp
-            jitter -= cycles_per_sample
+            jitter -= pace.next()
         }
         max := float32(-1.0)
         min := float32(1.0)
-        //wav := make([]int16, len(out))
         for _, s := range out {
             if s < min {
                 min = s
@@ -183,23 +369,26 @@ func (m *M6800) Callback(mmu mem.MMU16, ctrl chan uint8, pia *m6821.M6821) func(
             if s > max {
                 max = s
             }
-            //wav[i] = int16(s * 24000)
         }
-        //binary.Write(wavout, binary.LittleEndian, wav)
-
-        ui.Log(fmt.Sprintf("%dcyc, %dsamp in %v, jitter %.4f, %.3f..%.3f", total_cycles, len(out) / 2, time.Since(start), jitter, min, max))
+        if m.WavOut != nil {
+            binary.Write(m.WavOut, binary.LittleEndian, out)
+        }
+        if m.Logger == nil {
+            return
+        }
+        m.Logger(fmt.Sprintf("%dcyc, %dsamp in %v, jitter %d, %.3f..%.3f", total_cycles, len(out) / 2, time.Since(start), jitter, min, max))
     }
 }
 
 
-func (m *M6800) Run(mmu mem.MMU16, ctrl chan rune, screen tcell.Screen) {
+func (m *M6800) Run(mmu mem.MMU16, ctrl chan rune) {
     var chr rune
     var tick *time.Ticker
-    rate := float32(100)
-    cycles_per_rate := crystal / rate
-    tick = time.NewTicker(time.Duration(float32(time.Second)/rate))
+    rate := uint64(100)
+    pace := m.Clock.pacer(rate)
+    tick = time.NewTicker(time.Second / time.Duration(rate))
     _ = tick
-    var total, remainder float32
+    var owed int  // cycles still to run, negative if the last tick overran
     go func() {
         for {
             select {
@@ -208,18 +397,24 @@ func (m *M6800) Run(mmu mem.MMU16, ctrl chan rune, screen tcell.Screen) {
                         m.PIA.Write(1, uint8(chr-'0'))
                     }
                 case <-tick.C:
-                    total = remainder
+                    owed += pace.next()
 //                    start := time.Now()
                     // run one "rate" worth of cycles
-                    for {
-                        if total > cycles_per_rate {
-                            remainder = total - cycles_per_rate
+                    for owed > 0 {
+                        cycles, err := m.Exec(mmu, owed)
+                        if err != nil {
+                            // halted, don't save up cycles for after a reset
+                            owed = 0
                             break
                         }
-                        cycles, _ := m.Step(mmu)
-                        total += float32(cycles)
+                        owed -= cycles
+                        if m.parked() && owed > 0 {
+                            // nothing can wake the CPU before the next tick
+                            m.cycles += uint64(owed)
+                            owed = 0
+                        }
                     }
-//                    ui.Log(fmt.Sprintf("%f cycles in %s", total, time.Since(start)))
+//                    ui.Log(fmt.Sprintf("%d cycles in %s", owed, time.Since(start)))
 //                default:
 //                    m.Step(mmu)
             }
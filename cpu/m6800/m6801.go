@@ -0,0 +1,322 @@
+package m6800
+
+import (
+    "fmt"
+    "strings"
+
+    "github.com/bartgrantham/fpemu/mem"
+)
+
+// MC6801/6803 additions to the 6800 instruction set
+// page references are to the MC6801 Reference Manual (M6801RM(AD2)), section 4
+// the on-chip ports, timer and SCI at $00-$1F are not emulated, boards map
+// those through the MMU like anything else
+
+type Variant int
+
+const (
+    MC6800  Variant  = iota  // also 6802/6808
+    MC6801                   // also 6803
+    HD6301                   // also HD63701
+    NSC8105                  // scrambled opcodes
+)
+
+type variant struct {
+    name    string
+    ops     *[256]func(*M6800, mem.MMU16)
+    cycles  *[256]int
+    invalid int  // bit to test against OpcodeDesc.InvalidMask
+}
+
+var variants = [...]variant{
+    MC6800: {"M6802", &dispatch_table, &cyclecounts, 1},
+    MC6801: {"M6803", &dispatch_6801, &cyclecounts_6801, 2},
+    HD6301: {"HD6301", &dispatch_6301, &cyclecounts_6301, 4},
+    NSC8105: {"NSC8105", &dispatch_8105, &cyclecounts_8105, 1},
+}
+
+func (v Variant) String() string {
+    return variants[v].name
+}
+
+// Look up a variant by name, case-insensitive
+func ParseVariant(name string) (Variant, error) {
+    for v := range variants {
+        if strings.EqualFold(variants[v].name, name) {
+            return Variant(v), nil
+        }
+    }
+    return MC6800, fmt.Errorf("unknown CPU variant %q", name)
+}
+
+// MC6801 Reference Manual table 4-7
+var cyclecounts_6801 [256]int = [256]int{
+//  00  01  02  03  04  05  06  07  08  09  0A  0B  0C  0D  0E  0F
+    0,  2,  0,  0,  3,  3,  2,  2,  3,  3,  2,  2,  2,  2,  2,  2,  // 00
+    2,  2,  0,  0,  0,  0,  2,  2,  0,  2,  0,  2,  0,  0,  0,  0,  // 10
+    3,  3,  3,  3,  3,  3,  3,  3,  3,  3,  3,  3,  3,  3,  3,  3,  // 20
+    3,  3,  4,  4,  3,  3,  3,  3,  5,  5,  3,  10, 4,  10, 9,  12, // 30
+    2,  0,  0,  2,  2,  0,  2,  2,  2,  2,  2,  0,  2,  2,  0,  2,  // 40
+    2,  0,  0,  2,  2,  0,  2,  2,  2,  2,  2,  0,  2,  2,  0,  2,  // 50
+    6,  0,  0,  6,  6,  0,  6,  6,  6,  6,  6,  0,  6,  6,  3,  6,  // 60
+    6,  0,  0,  6,  6,  0,  6,  6,  6,  6,  6,  0,  6,  6,  3,  6,  // 70
+    2,  2,  2,  4,  2,  2,  2,  0,  2,  2,  2,  2,  4,  6,  3,  0,  // 80
+    3,  3,  3,  5,  3,  3,  3,  3,  3,  3,  3,  3,  5,  5,  4,  4,  // 90
+    4,  4,  4,  6,  4,  4,  4,  4,  4,  4,  4,  4,  6,  6,  5,  5,  // A0
+    4,  4,  4,  6,  4,  4,  4,  4,  4,  4,  4,  4,  6,  6,  5,  5,  // B0
+    2,  2,  2,  4,  2,  2,  2,  0,  2,  2,  2,  2,  3,  0,  3,  0,  // C0
+    3,  3,  3,  5,  3,  3,  3,  3,  3,  3,  3,  3,  4,  4,  4,  4,  // D0
+    4,  4,  4,  6,  4,  4,  4,  4,  4,  4,  4,  4,  5,  5,  5,  5,  // E0
+    4,  4,  4,  6,  4,  4,  4,  4,  4,  4,  4,  4,  5,  5,  5,  5,  // F0
+}
+
+// opcodes the 6801 adds to (or changes from) dispatch_table
+var ops_6801 = map[uint8]func(*M6800, mem.MMU16){
+    0x04:LSRD_04, 0x05:ASLD_05, 0x21:BRN_21, 0x38:PULX_38, 0x3A:ABX_3A, 0x3C:PSHX_3C, 0x3D:MUL_3D,
+    0x83:SUBD_83, 0x93:SUBD_93, 0xA3:SUBD_A3, 0xB3:SUBD_B3, 0x9D:JSR_9D,
+    0xC3:ADDD_C3, 0xD3:ADDD_D3, 0xE3:ADDD_E3, 0xF3:ADDD_F3,
+    0xCC:LDD_CC, 0xDC:LDD_DC, 0xEC:LDD_EC, 0xFC:LDD_FC,
+    0xDD:STD_DD, 0xED:STD_ED, 0xFD:STD_FD,
+}
+
+var dispatch_6801 [256]func(*M6800, mem.MMU16)
+
+func init() {
+    dispatch_6801 = dispatch_table
+    for opcode, f := range ops_6801 {
+        dispatch_6801[opcode] = f
+    }
+}
+
+// D is A:B, A is the high byte
+func (m *M6800) D() uint16 {
+    return uint16(m.A)<<8 | uint16(m.B)
+}
+
+func (m *M6800) SetD(val uint16) {
+    m.A = uint8(val >> 8)
+    m.B = uint8(val)
+}
+
+// Logical Shift Right D, flags:NZVC (4-48)
+func LSRD_04(m *M6800, mmu mem.MMU16) {
+    d := m.D()
+    if d & 0x0001 == 0x0001 {
+        m.CC |= C
+        m.CC |= V
+    } else {
+        m.CC &= ^C
+        m.CC &= ^V
+    }
+    d >>= 1
+    m.SetD(d)
+    m.set_NZ16(d)
+}
+
+// Arithmetic Shift Left D, flags:NZVC (4-29)
+func ASLD_05(m *M6800, mmu mem.MMU16) {
+    d := m.D()
+    if d & 0x8000 == 0x8000 {
+        m.CC |= C
+    } else {
+        m.CC &= ^C
+    }
+    d <<= 1
+    m.SetD(d)
+    m.set_NZ16(d)
+    switch {
+        case (m.CC & N == N) && (m.CC & C != C):
+            // negative, no carry
+            m.CC |= V
+        case (m.CC & N != N) && (m.CC & C == C):
+            // positive, carry
+            m.CC |= V
+        default:
+            m.CC &= ^V
+    }
+}
+
+// Branch never, no flags (4-34)
+func BRN_21(m *M6800, mmu mem.MMU16) {
+    _ = mmu.R8(m.PC)
+    m.PC += 1
+}
+
+// Pull X from stack, no flags (4-60)
+func PULX_38(m *M6800, mmu mem.MMU16) {
+    m.X = mmu.R16(m.SP+1)
+    m.SP += 2
+}
+
+// Add B to X, unsigned, no flags (4-23)
+func ABX_3A(m *M6800, mmu mem.MMU16) {
+    m.X += uint16(m.B)
+}
+
+// Push X to stack, no flags (4-58)
+func PSHX_3C(m *M6800, mmu mem.MMU16) {
+    mmu.W16(m.SP-1, m.X)
+    m.SP -= 2
+}
+
+// Multiply A by B into D, unsigned, flags:C (4-55)
+// C is bit 7 of the result so that ADCA #0 rounds D to A
+func MUL_3D(m *M6800, mmu mem.MMU16) {
+    d := uint16(m.A) * uint16(m.B)
+    m.SetD(d)
+    if d & 0x0080 == 0x0080 {
+        m.CC |= C
+    } else {
+        m.CC &= ^C
+    }
+}
+
+// Subtract IMM from D, flags:NZVC (4-71)
+func SUBD_83(m *M6800, mmu mem.MMU16) {
+    m.SetD(m.sub16(m.D(), mmu.R16(m.PC)))
+    m.PC += 2
+}
+
+// Subtract DIR from D, flags:NZVC (4-71)
+func SUBD_93(m *M6800, mmu mem.MMU16) {
+    m.SetD(m.sub16(m.D(), mmu.R16(uint16(mmu.R8(m.PC)))))
+    m.PC += 1
+}
+
+// Jump to subroutine DIR, no flags (4-46)
+func JSR_9D(m *M6800, mmu mem.MMU16) {
+    addr := uint16(mmu.R8(m.PC))
+    m.PC += 1
+    mmu.W16(m.SP-1, m.PC)
+    m.SP -= 2
+    m.PC = addr
+}
+
+// Subtract IND from D, flags:NZVC (4-71)
+func SUBD_A3(m *M6800, mmu mem.MMU16) {
+    m.SetD(m.sub16(m.D(), mmu.R16(m.X + uint16(mmu.R8(m.PC)))))
+    m.PC += 1
+}
+
+// Subtract EXT from D, flags:NZVC (4-71)
+func SUBD_B3(m *M6800, mmu mem.MMU16) {
+    m.SetD(m.sub16(m.D(), mmu.R16(mmu.R16(m.PC))))
+    m.PC += 2
+}
+
+// Add IMM to D, flags:NZVC (4-24)
+func ADDD_C3(m *M6800, mmu mem.MMU16) {
+    m.SetD(m.add16(m.D(), mmu.R16(m.PC)))
+    m.PC += 2
+}
+
+// Load D from IMM, flags:NZV (4-50)
+func LDD_CC(m *M6800, mmu mem.MMU16) {
+    m.SetD(mmu.R16(m.PC))
+    m.CC &= ^V
+    m.set_NZ16(m.D())
+    m.PC += 2
+}
+
+// Add DIR to D, flags:NZVC (4-24)
+func ADDD_D3(m *M6800, mmu mem.MMU16) {
+    m.SetD(m.add16(m.D(), mmu.R16(uint16(mmu.R8(m.PC)))))
+    m.PC += 1
+}
+
+// Load D from DIR, flags:NZV (4-50)
+func LDD_DC(m *M6800, mmu mem.MMU16) {
+    m.SetD(mmu.R16(uint16(mmu.R8(m.PC))))
+    m.CC &= ^V
+    m.set_NZ16(m.D())
+    m.PC += 1
+}
+
+// Store D to DIR, flags:NZV (4-67)
+func STD_DD(m *M6800, mmu mem.MMU16) {
+    mmu.W16(uint16(mmu.R8(m.PC)), m.D())
+    m.CC &= ^V
+    m.set_NZ16(m.D())
+    m.PC += 1
+}
+
+// Add IND to D, flags:NZVC (4-24)
+func ADDD_E3(m *M6800, mmu mem.MMU16) {
+    m.SetD(m.add16(m.D(), mmu.R16(m.X + uint16(mmu.R8(m.PC)))))
+    m.PC += 1
+}
+
+// Load D from IND, flags:NZV (4-50)
+func LDD_EC(m *M6800, mmu mem.MMU16) {
+    m.SetD(mmu.R16(m.X + uint16(mmu.R8(m.PC))))
+    m.CC &= ^V
+    m.set_NZ16(m.D())
+    m.PC += 1
+}
+
+// Store D to IND, flags:NZV (4-67)
+func STD_ED(m *M6800, mmu mem.MMU16) {
+    mmu.W16(m.X + uint16(mmu.R8(m.PC)), m.D())
+    m.CC &= ^V
+    m.set_NZ16(m.D())
+    m.PC += 1
+}
+
+// Add EXT to D, flags:NZVC (4-24)
+func ADDD_F3(m *M6800, mmu mem.MMU16) {
+    m.SetD(m.add16(m.D(), mmu.R16(mmu.R16(m.PC))))
+    m.PC += 2
+}
+
+// Load D from EXT, flags:NZV (4-50)
+func LDD_FC(m *M6800, mmu mem.MMU16) {
+    m.SetD(mmu.R16(mmu.R16(m.PC)))
+    m.CC &= ^V
+    m.set_NZ16(m.D())
+    m.PC += 2
+}
+
+// Store D to EXT, flags:NZV (4-67)
+func STD_FD(m *M6800, mmu mem.MMU16) {
+    mmu.W16(mmu.R16(m.PC), m.D())
+    m.CC &= ^V
+    m.set_NZ16(m.D())
+    m.PC += 2
+}
+
+// common function to ADDD, handles NZVC flags
+func (m *M6800) add16(augend, addend uint16) uint16 {
+    wide := uint32(augend) + uint32(addend)
+    sum := uint16(wide)
+    if wide > 0xFFFF {
+        m.CC |= C
+    } else {
+        m.CC &= ^C
+    }
+    // both operands the same sign, sum the opposite
+    if (augend ^ sum) & (addend ^ sum) & 0x8000 != 0 {
+        m.CC |= V
+    } else {
+        m.CC &= ^V
+    }
+    m.set_NZ16(sum)
+    return sum
+}
+
+// common function to SUBD, handles NZVC flags
+func (m *M6800) sub16(minuend, subtrahend uint16) uint16 {
+    difference := minuend - subtrahend
+    if minuend < subtrahend {
+        m.CC |= C
+    } else {
+        m.CC &= ^C
+    }
+    // operands of opposite sign, difference the opposite of the minuend
+    if (minuend ^ subtrahend) & (minuend ^ difference) & 0x8000 != 0 {
+        m.CC |= V
+    } else {
+        m.CC &= ^V
+    }
+    m.set_NZ16(difference)
+    return difference
+}
@@ -0,0 +1,77 @@
+package m6800
+
+import (
+    "github.com/bartgrantham/fpemu/mem"
+)
+
+// National Semiconductor NSC-8105
+// a 6800 with the opcode bits scrambled, plus four extra instructions that
+// land on slots that are illegal on the 6800 once unscrambled
+// there is no datasheet, the semantics of the extras are guesses from the code
+// that uses them (and MAME), noted on each
+
+// bits 0/1 and 6/7 of the opcode are swapped, 2-5 are untouched
+func nsc8105_swap(code uint8) uint8 {
+    return (code & 0x3c) | ((code & 0x41) << 1) | ((code & 0x82) >> 1)
+}
+
+// unscrambled opcode -> index into M6800Ops of the NSC-8105 extras
+var nsc8105_extra = map[uint8]int{0xfc:0x100, 0xec:0x101, 0x7b:0x102, 0x71:0x103}
+
+var cyclecounts_8105 [256]int
+var dispatch_8105 [256]func(*M6800, mem.MMU16)
+
+func init() {
+    // indexed by the raw (scrambled) opcode
+    for raw := range dispatch_8105 {
+        code := nsc8105_swap(uint8(raw))
+        dispatch_8105[raw] = dispatch_table[code]
+        cyclecounts_8105[raw] = cyclecounts[code]
+    }
+    for code, f := range map[uint8]func(*M6800, mem.MMU16){
+        0xfc:ADDX_FC, 0xec:ADCX_EC, 0x7b:BITX_7B, 0x71:STX_71,
+    } {
+        raw := nsc8105_swap(code)  // the swap is its own inverse
+        dispatch_8105[raw] = f
+    }
+    // timings are guesses, the same as the nearest 6800 instruction
+    cyclecounts_8105[nsc8105_swap(0xfc)] = 6
+    cyclecounts_8105[nsc8105_swap(0xec)] = 4
+    cyclecounts_8105[nsc8105_swap(0x7b)] = 6
+    cyclecounts_8105[nsc8105_swap(0x71)] = 7
+}
+
+// Add EXT to X, flags:NZVC
+// flags are a guess, the same as ADDD
+func ADDX_FC(m *M6800, mmu mem.MMU16) {
+    m.X = m.add16(m.X, mmu.R16(mmu.R16(m.PC)))
+    m.PC += 2
+}
+
+// Add IMM and carry to X, unsigned, flags:NZVC
+// flags are a guess, the same as ADDD
+func ADCX_EC(m *M6800, mmu mem.MMU16) {
+    carry := uint16(m.CC & C)
+    m.X = m.add16(m.X, uint16(mmu.R8(m.PC)) + carry)
+    m.PC += 1
+}
+
+// Test IMM against IND, flags:NZV
+// like the 6301 TIM
+func BITX_7B(m *M6800, mmu mem.MMU16) {
+    imm := mmu.R8(m.PC)
+    addr := m.X + uint16(mmu.R8(m.PC+1))
+    m.CC &= ^V
+    m.set_NZ8(mmu.R8(addr) & imm)
+    m.PC += 2
+}
+
+// Store X to IND, flags:NZV
+// the first operand byte is fetched and ignored
+func STX_71(m *M6800, mmu mem.MMU16) {
+    _ = mmu.R8(m.PC)
+    mmu.W16(m.X + uint16(mmu.R8(m.PC+1)), m.X)
+    m.CC &= ^V
+    m.set_NZ16(m.X)
+    m.PC += 2
+}
@@ -1,8 +1,6 @@
 package m6800
 
 import (
-    "fmt"
-
     "github.com/bartgrantham/fpemu/mem"
 )
 
@@ -41,42 +39,46 @@ var cyclecounts [256]int = [256]int{
 var dispatch_table [256]func(*M6800, mem.MMU16) = [256]func(*M6800, mem.MMU16) {
 //  00      01      02      03      04      05      06      07      08      09      0A      0B      0C      0D      0E      0F
     INVALD, NOP_01, INVALD, INVALD, INVALD, INVALD, TAP_06, TPA_07, INX_08, DEX_09, CLV_0A, SEV_0B, CLC_0C, SEC_0D, CLI_0E, SEI_0F, //00
-    SBA_10, CBA_11, INVALD, INVALD, INVALD, INVALD, TAB_16, TBA_17, INVALD, UNIMPL, INVALD, ABA_1B, INVALD, INVALD, INVALD, INVALD, //10
-    BRA_20, INVALD, BHI_22, BLS_23, BCC_24, BCS_25, BNE_26, BEQ_27, BVC_28, UNIMPL, BPL_2A, BMI_2B, UNIMPL, BLT_2D, BGT_2E, BLE_2F, //20
-    UNIMPL, UNIMPL, PUL_32, PUL_33, UNIMPL, UNIMPL, PSH_36, PSH_37, INVALD, RTS_39, INVALD, RTI_3B, INVALD, INVALD, UNIMPL, UNIMPL, //30
-    UNIMPL, INVALD, INVALD, COM_43, LSR_44, INVALD, ROR_46, ASR_47, ASL_48, ROL_49, DEC_4A, INVALD, INC_4C, TST_4D, INVALD, CLR_4F, //40
-    NEG_50, INVALD, INVALD, COM_53, LSR_54, INVALD, ROR_56, UNIMPL, ASL_58, ROL_59, DEC_5A, INVALD, INC_5C, TST_5D, INVALD, CLR_5F, //50
-    NEG_60, INVALD, INVALD, UNIMPL, UNIMPL, INVALD, UNIMPL, UNIMPL, UNIMPL, UNIMPL, DEC_6A, INVALD, UNIMPL, TST_6D, JMP_6E, CLR_6F, //60
-    NEG_70, INVALD, INVALD, COM_73, LSR_74, INVALD, ROR_76, UNIMPL, ASL_78, ROL_79, DEC_7A, INVALD, INC_7C, TST_7D, JMP_7E, CLR_7F, //70
+    SBA_10, CBA_11, INVALD, INVALD, INVALD, INVALD, TAB_16, TBA_17, INVALD, DAA_19, INVALD, ABA_1B, INVALD, INVALD, INVALD, INVALD, //10
+    BRA_20, INVALD, BHI_22, BLS_23, BCC_24, BCS_25, BNE_26, BEQ_27, BVC_28, BVS_29, BPL_2A, BMI_2B, BGE_2C, BLT_2D, BGT_2E, BLE_2F, //20
+    TSX_30, INS_31, PUL_32, PUL_33, DES_34, TXS_35, PSH_36, PSH_37, INVALD, RTS_39, INVALD, RTI_3B, INVALD, INVALD, WAI_3E, SWI_3F, //30
+    NEG_40, INVALD, INVALD, COM_43, LSR_44, INVALD, ROR_46, ASR_47, ASL_48, ROL_49, DEC_4A, INVALD, INC_4C, TST_4D, INVALD, CLR_4F, //40
+    NEG_50, INVALD, INVALD, COM_53, LSR_54, INVALD, ROR_56, ASR_57, ASL_58, ROL_59, DEC_5A, INVALD, INC_5C, TST_5D, INVALD, CLR_5F, //50
+    NEG_60, INVALD, INVALD, COM_63, LSR_64, INVALD, ROR_66, ASR_67, ASL_68, ROL_69, DEC_6A, INVALD, INC_6C, TST_6D, JMP_6E, CLR_6F, //60
+    NEG_70, INVALD, INVALD, COM_73, LSR_74, INVALD, ROR_76, ASR_77, ASL_78, ROL_79, DEC_7A, INVALD, INC_7C, TST_7D, JMP_7E, CLR_7F, //70
     SUB_80, CMP_81, SBC_82, INVALD, AND_84, BIT_85, LDA_86, INVALD, EOR_88, ADC_89, ORA_8A, ADD_8B, CPX_8C, BSR_8D, LDS_8E, INVALD, //80
-    SUB_90, CMP_91, SBC_92, INVALD, AND_94, UNIMPL, LDA_96, STA_97, EOR_98, ADC_99, ORA_9A, ADD_9B, CPX_9C, INVALD, LDS_9E, STS_9F, //90
-    SUB_A0, UNIMPL, UNIMPL, INVALD, UNIMPL, UNIMPL, LDA_A6, STA_A7, UNIMPL, UNIMPL, UNIMPL, ADD_AB, UNIMPL, JSR_AD, UNIMPL, UNIMPL, //A0
-    UNIMPL, CMP_B1, UNIMPL, INVALD, AND_B4, UNIMPL, LDA_B6, STA_B7, EOR_B8, ADC_B9, UNIMPL, ADD_BB, CPX_BC, JSR_BD, UNIMPL, UNIMPL, //B0
+    SUB_90, CMP_91, SBC_92, INVALD, AND_94, BIT_95, LDA_96, STA_97, EOR_98, ADC_99, ORA_9A, ADD_9B, CPX_9C, INVALD, LDS_9E, STS_9F, //90
+    SUB_A0, CMP_A1, SBC_A2, INVALD, AND_A4, BIT_A5, LDA_A6, STA_A7, EOR_A8, ADC_A9, ORA_AA, ADD_AB, CPX_AC, JSR_AD, LDS_AE, STS_AF, //A0
+    SUB_B0, CMP_B1, SBC_B2, INVALD, AND_B4, BIT_B5, LDA_B6, STA_B7, EOR_B8, ADC_B9, ORA_BA, ADD_BB, CPX_BC, JSR_BD, LDS_BE, STS_BF, //B0
     SUB_C0, CMP_C1, SBC_C2, INVALD, AND_C4, BIT_C5, LDA_C6, INVALD, EOR_C8, ADC_C9, ORA_CA, ADD_CB, INVALD, INVALD, LDX_CE, INVALD, //C0
-    SUB_D0, CMP_D1, SBC_D2, INVALD, AND_D4, UNIMPL, LDA_D6, STA_D7, EOR_D8, ADC_D9, UNIMPL, ADD_DB, INVALD, INVALD, LDX_DE, STX_DF, //D0
-    UNIMPL, CMP_E1, UNIMPL, INVALD, AND_E4, BIT_E5, LDA_E6, STA_E7, UNIMPL, UNIMPL, UNIMPL, ADD_EB, INVALD, INVALD, LDX_EE, STX_EF, //E0
-    SUB_F0, CMP_F1, UNIMPL, INVALD, UNIMPL, UNIMPL, LDA_F6, STA_F7, UNIMPL, UNIMPL, UNIMPL, ADD_FB, INVALD, INVALD, LDX_FE, STX_FF, //F0
+    SUB_D0, CMP_D1, SBC_D2, INVALD, AND_D4, BIT_D5, LDA_D6, STA_D7, EOR_D8, ADC_D9, ORA_DA, ADD_DB, INVALD, INVALD, LDX_DE, STX_DF, //D0
+    SUB_E0, CMP_E1, SBC_E2, INVALD, AND_E4, BIT_E5, LDA_E6, STA_E7, EOR_E8, ADC_E9, ORA_EA, ADD_EB, INVALD, INVALD, LDX_EE, STX_EF, //E0
+    SUB_F0, CMP_F1, SBC_F2, INVALD, AND_F4, BIT_F5, LDA_F6, STA_F7, EOR_F8, ADC_F9, ORA_FA, ADD_FB, INVALD, INVALD, LDX_FE, STX_FF, //F0
 //  00      01      02      03      04      05      06      07      08      09      0A      0B      0C      0D      0E      0F
 }
 
-var op uint8
-
 func (m *M6800) dispatch(opcode uint8, mmu mem.MMU16) (int, error) {
-    op = opcode
-    dispatch_table[opcode](m, mmu)
-    return cyclecounts[opcode], nil
+    ops, cycles := m.tables()
+    m.op = opcode
+    m.bus.begin(mmu, m.cycles, cycles[opcode])
+    ops[opcode](m, &m.bus)
+    m.bus.flush()
+    if m.Fault != nil {
+        return 0, m.Fault
+    }
+    return cycles[opcode], nil
 }
 
-// Unimplemented opcode
+// Unimplemented opcode, halts the CPU on the opcode
 func UNIMPL(m *M6800, mmu mem.MMU16) {
-    status := fmt.Sprintf("\nUnimplmented opcode: %.2X\n    CPU status: %s", op, m.Status())
-    panic(status)
+    m.PC -= 1
+    m.Fault = ErrUnimplemented{PC:m.PC, Opcode:m.op, CPU:m.Registers}
 }
 
-// Invalid opcode
+// Invalid opcode, halts the CPU on the opcode
 func INVALD(m *M6800, mmu mem.MMU16) {
-    status := fmt.Sprintf("\nInvalid opcode: %.2X\n    CPU status: %s", op, m.Status())
-    panic(status)
+    m.PC -= 1
+    m.Fault = ErrIllegalOpcode{PC:m.PC, Opcode:m.op, CPU:m.Registers}
 }
 
 // No Operation, no flags (A-50)
@@ -171,6 +173,27 @@ func TBA_17(m *M6800, mmu mem.MMU16) {
     m.set_NZ8(m.A)
 }
 
+// Decimal Adjust A, flags:NZVC (A-34)
+func DAA_19(m *M6800, mmu mem.MMU16) {
+    msn := m.A & 0xF0
+    lsn := m.A & 0x0F
+    correction := uint8(0)
+    if lsn > 0x09 || m.CC & H == H {
+        correction |= 0x06
+    }
+    if (msn > 0x80 && lsn > 0x09) || msn > 0x90 || m.CC & C == C {
+        correction |= 0x60
+    }
+    sum := uint16(m.A) + uint16(correction)
+    // C is only ever set here, never cleared (A-34)
+    if sum > 0xFF {
+        m.CC |= C
+    }
+    m.A = uint8(sum)
+    m.CC &= ^V
+    m.set_NZ8(m.A)
+}
+
 // Add B to A, flags:HNZVC (A-3)
 func ABA_1B(m *M6800, mmu mem.MMU16) {
     augend := m.A
@@ -332,6 +355,22 @@ func BMI_2B(m *M6800, mmu mem.MMU16) {
     }
 }
 
+// Branch if greater or equal ((N&V)|(!N&!V)), no flags (A-12)
+func BGE_2C(m *M6800, mmu mem.MMU16) {
+    offset := mmu.R8(m.PC)
+    m.PC += 1
+    v := m.CC & V == V
+    n := m.CC & N == N
+    if (n && v) || (!n && !v) {
+        if offset & 0x80 == 0x80 {
+            offset = ^offset + 1
+            m.PC -= uint16(offset)
+        } else {
+            m.PC += uint16(offset)
+        }
+    }
+}
+
 // Branch if less than ((V&!N)|(N&!V)), no flags (A-18)
 func BLT_2D(m *M6800, mmu mem.MMU16) {
     offset := mmu.R8(m.PC)
@@ -384,11 +423,16 @@ func BLE_2F(m *M6800, mmu mem.MMU16) {
 }
 
 
-// untested
-//func TSX_30(m *M6800, mmu mem.MMU16) {
-//    m.X = m.SP + 1  // memory?
-//    // Condition Codes not affected (A-74)
-//}
+// Transfer SP to X, no flags (A-74)
+// X points at the last byte pushed, ie. one above SP
+func TSX_30(m *M6800, mmu mem.MMU16) {
+    m.X = m.SP + 1
+}
+
+// Increment SP, no flags (A-41)
+func INS_31(m *M6800, mmu mem.MMU16) {
+    m.SP += 1
+}
 
 
 // Pull from stack to A, no flags (A-53)
@@ -403,11 +447,16 @@ func PUL_33(m *M6800, mmu mem.MMU16) {
     m.B = mmu.R8(m.SP)
 }
 
-// untested
-///func TXS_35(m *M6800, mmu mem.MMU16) {
-//    m.SP = m.X - 1   // memory?
-//    // Condition Codes not affected (A-75)
-//}
+// Decrement SP, no flags (A-37)
+func DES_34(m *M6800, mmu mem.MMU16) {
+    m.SP -= 1
+}
+
+// Transfer X to SP, no flags (A-75)
+// the inverse of TSX, SP ends up one below X
+func TXS_35(m *M6800, mmu mem.MMU16) {
+    m.SP = m.X - 1
+}
 
 
 // Pull from A to stack, no flags (A-52)
@@ -439,7 +488,20 @@ func RTI_3B(m*M6800, mmu mem.MMU16) {
     m.SP += 7
 }
 
-// untested... is setting V and C before negation correct?
+// Wait for Interrupt, flags:I on interrupt (A-76)
+// registers are stacked now so an interrupt can be serviced without the 7-byte push
+func WAI_3E(m *M6800, mmu mem.MMU16) {
+    m.save_registers(mmu)
+    m.Waiting = true
+}
+
+// Software Interrupt, flags:I (A-68)
+func SWI_3F(m *M6800, mmu mem.MMU16) {
+    m.save_registers(mmu)
+    m.CC |= I
+    m.PC = mmu.R16(0xFFFA)
+}
+
 // Negate A, flags:NZVC (A-49)
 func NEG_40(m *M6800, mmu mem.MMU16) {
     if m.A == 0x80 {
@@ -611,7 +673,6 @@ func CLR_4F(m *M6800, mmu mem.MMU16) {
     m.CC &= ^C
 }
 
-// untested... is setting V and C before negation correct?
 // Negate B, flags:NZVC (A-49)
 func NEG_50(m *M6800, mmu mem.MMU16) {
     if m.B == 0x80 {
@@ -674,6 +735,29 @@ func ROR_56(m *M6800, mmu mem.MMU16) {
     }
 }
 
+// Arithmetic Shift Right B, flags:NZVC (A-8)
+func ASR_57(m *M6800, mmu mem.MMU16) {
+    bit7 := m.B & 0x80
+    if m.B & 0x01 == 0x01 {
+        m.CC |= C
+    } else {
+        m.CC &= ^C
+    }
+    m.B = m.B >> 1
+    m.B |= bit7    // "Bit 7 is held constant." (A-8)
+    m.set_NZ8(m.B)
+    switch {
+        case (m.CC & N == N) && (m.CC & C != C):
+            // negative, no carry
+            m.CC |= V
+        case (m.CC & N != N) && (m.CC & C == C):
+            // positive, carry
+            m.CC |= V
+        default:
+            m.CC &= ^V
+    }
+}
+
 // Arithmetic Shift Left B, flags:NZVC (A-7)
 func ASL_58(m *M6800, mmu mem.MMU16) {
     if m.B & 0x80 == 0x80 {
@@ -759,7 +843,6 @@ func CLR_5F(m *M6800, mmu mem.MMU16) {
     m.CC &= ^C
 }
 
-// untested... is setting V and C before negation correct?
 // Negate IND, flags:NZVC (A-49)
 func NEG_60(m *M6800, mmu mem.MMU16) {
     addr := m.X + uint16(mmu.R8(m.PC))
@@ -780,6 +863,145 @@ func NEG_60(m *M6800, mmu mem.MMU16) {
     m.PC += 1
 }
 
+// Compliment IND, flags:NZVC (A-32)
+func COM_63(m *M6800, mmu mem.MMU16) {
+    addr := m.X + uint16(mmu.R8(m.PC))
+    tmp := mmu.R8(addr)
+    tmp = ^tmp
+    m.CC |= C
+    m.CC &= ^V
+    m.set_NZ8(tmp)
+    mmu.W8(addr, tmp)
+    m.PC += 1
+}
+
+// Logical Shift Right IND, flags:NZVC (A-48)
+func LSR_64(m *M6800, mmu mem.MMU16) {
+    addr := m.X + uint16(mmu.R8(m.PC))
+    tmp := mmu.R8(addr)
+    if tmp & 0x01 == 0x01 {
+        m.CC |= C
+        m.CC |= V
+    } else {
+        m.CC &= ^C
+        m.CC &= ^V
+    }
+    tmp >>= 1
+    m.set_NZ8(tmp)
+    mmu.W8(addr, tmp)
+    m.PC += 1
+}
+
+// Rotate Right Through Carry IND, flags:NZVC (A-55)
+func ROR_66(m *M6800, mmu mem.MMU16) {
+    addr := m.X + uint16(mmu.R8(m.PC))
+    tmp := mmu.R8(addr)
+    wrap := m.CC & C == C
+    if tmp & 0x01 == 0x01 {
+        m.CC |= C
+    } else {
+        m.CC &= ^C
+    }
+    tmp = tmp >> 1
+    if wrap {
+        tmp |= 0x80
+    }
+    m.set_NZ8(tmp)
+    switch {
+        case (m.CC & N == N) && (m.CC & C != C):
+            // negative, no carry
+            m.CC |= V
+        case (m.CC & N != N) && (m.CC & C == C):
+            // positive, carry
+            m.CC |= V
+        default:
+            m.CC &= ^V
+    }
+    mmu.W8(addr, tmp)
+    m.PC += 1
+}
+
+// Arithmetic Shift Right IND, flags:NZVC (A-8)
+func ASR_67(m *M6800, mmu mem.MMU16) {
+    addr := m.X + uint16(mmu.R8(m.PC))
+    tmp := mmu.R8(addr)
+    bit7 := tmp & 0x80
+    if tmp & 0x01 == 0x01 {
+        m.CC |= C
+    } else {
+        m.CC &= ^C
+    }
+    tmp = tmp >> 1
+    tmp |= bit7    // "Bit 7 is held constant." (A-8)
+    m.set_NZ8(tmp)
+    switch {
+        case (m.CC & N == N) && (m.CC & C != C):
+            // negative, no carry
+            m.CC |= V
+        case (m.CC & N != N) && (m.CC & C == C):
+            // positive, carry
+            m.CC |= V
+        default:
+            m.CC &= ^V
+    }
+    mmu.W8(addr, tmp)
+    m.PC += 1
+}
+
+// Arithmetic Shift Left IND, flags:NZVC (A-7)
+func ASL_68(m *M6800, mmu mem.MMU16) {
+    addr := m.X + uint16(mmu.R8(m.PC))
+    tmp := mmu.R8(addr)
+    if tmp & 0x80 == 0x80 {
+        m.CC |= C
+    } else {
+        m.CC &= ^C
+    }
+    tmp = tmp << 1
+    m.set_NZ8(tmp)
+    switch {
+        case (m.CC & N == N) && (m.CC & C != C):
+            // negative, no carry
+            m.CC |= V
+        case (m.CC & N != N) && (m.CC & C == C):
+            // positive, carry
+            m.CC |= V
+        default:
+            m.CC &= ^V
+    }
+    mmu.W8(addr, tmp)
+    m.PC += 1
+}
+
+// Rotate Left Through Carry IND, flags:NZVC (A-54)
+func ROL_69(m *M6800, mmu mem.MMU16) {
+    addr := m.X + uint16(mmu.R8(m.PC))
+    tmp := mmu.R8(addr)
+    wrap := m.CC & C == C
+    if tmp & 0x80 == 0x80 {
+        m.CC |= C
+    } else {
+        m.CC &= ^C
+    }
+    tmp = tmp << 1
+    if wrap {
+        tmp |= 0x01
+    }
+    m.set_NZ8(tmp)
+    switch {
+        case (m.CC & N == N) && (m.CC & C != C):
+            // negative, no carry
+            m.CC |= V
+        case (m.CC & N != N) && (m.CC & C == C):
+            // positive, carry
+            m.CC |= V
+        default:
+            m.CC &= ^V
+    }
+    mmu.W8(addr, tmp)
+    m.PC += 1
+}
+
 // Decrement IND, flags:NZV (A-36)
 func DEC_6A(m *M6800, mmu mem.MMU16) {
     addr := m.X + uint16(mmu.R8(m.PC))
@@ -795,6 +1017,21 @@ func DEC_6A(m *M6800, mmu mem.MMU16) {
     m.PC += 1
 }
 
+// Increment IND, flags:NZV (A-40)
+func INC_6C(m *M6800, mmu mem.MMU16) {
+    addr := m.X + uint16(mmu.R8(m.PC))
+    tmp := mmu.R8(addr)
+    if tmp == 0x7f {
+        m.CC |= V
+    } else {
+        m.CC &= ^V
+    }
+    tmp += 1
+    m.set_NZ8(tmp)
+    mmu.W8(addr, tmp)
+    m.PC += 1
+}
+
 // Test IND, flags:NZCV (A-73)
 func TST_6D(m *M6800, mmu mem.MMU16) {
     addr := m.X + uint16(mmu.R8(m.PC))
@@ -822,7 +1059,6 @@ func CLR_6F(m *M6800, mmu mem.MMU16) {
     m.PC += 1
 }
 
-// untested... is setting V and C before negation correct?
 // Negate EXT, flags:NZVC (A-49)
 func NEG_70(m *M6800, mmu mem.MMU16) {
     addr := mmu.R16(m.PC)
@@ -900,6 +1136,33 @@ func ROR_76(m *M6800, mmu mem.MMU16) {
     m.PC += 2
 }
 
+// Arithmetic Shift Right EXT, flags:NZVC (A-8)
+func ASR_77(m *M6800, mmu mem.MMU16) {
+    addr := mmu.R16(m.PC)
+    tmp := mmu.R8(addr)
+    bit7 := tmp & 0x80
+    if tmp & 0x01 == 0x01 {
+        m.CC |= C
+    } else {
+        m.CC &= ^C
+    }
+    tmp = tmp >> 1
+    tmp |= bit7    // "Bit 7 is held constant." (A-8)
+    m.set_NZ8(tmp)
+    switch {
+        case (m.CC & N == N) && (m.CC & C != C):
+            // negative, no carry
+            m.CC |= V
+        case (m.CC & N != N) && (m.CC & C == C):
+            // positive, carry
+            m.CC |= V
+        default:
+            m.CC &= ^V
+    }
+    mmu.W8(addr, tmp)
+    m.PC += 2
+}
+
 // Arithmetic Shift Left EXT, flags:NZVC (A-7)
 func ASL_78(m *M6800, mmu mem.MMU16) {
     addr := mmu.R16(m.PC)
@@ -1111,6 +1374,14 @@ func CPX_8C(m *M6800, mmu mem.MMU16) {
             m.CC &= ^V
     }
     m.set_NZ16(difference)
+    // the 6801 and 6301 also set C on borrow
+    if m.Variant == MC6801 || m.Variant == HD6301 {
+        if m.X < subtrahend {
+            m.CC |= C
+        } else {
+            m.CC &= ^C
+        }
+    }
     m.PC += 2
 }
 
@@ -1168,6 +1439,13 @@ func AND_94(m *M6800, mmu mem.MMU16) {
     m.PC += 1
 }
 
+// Bit A with DIR, flags:NZV (A-15)
+func BIT_95(m *M6800, mmu mem.MMU16) {
+    m.CC &= ^V
+    m.set_NZ8(m.A & mmu.R8(uint16(mmu.R8(m.PC))))
+    m.PC += 1
+}
+
 // Load A with DIR, flags:NZV (A-45)
 func LDA_96(m *M6800, mmu mem.MMU16) {
     m.A = mmu.R8(uint16(mmu.R8(m.PC)))
@@ -1237,6 +1515,14 @@ func CPX_9C(m *M6800, mmu mem.MMU16) {
             m.CC &= ^V
     }
     m.set_NZ16(difference)
+    // the 6801 and 6301 also set C on borrow
+    if m.Variant == MC6801 || m.Variant == HD6301 {
+        if m.X < subtrahend {
+            m.CC |= C
+        } else {
+            m.CC &= ^C
+        }
+    }
     m.PC += 1
 }
 
@@ -1264,6 +1550,37 @@ func SUB_A0(m *M6800, mmu mem.MMU16) {
     m.PC += 1
 }
 
+// Compare IND from A, flags:NZVC (A-31)
+func CMP_A1(m *M6800, mmu mem.MMU16) {
+    minuend := m.A
+    subtrahend := mmu.R8(m.X + uint16(mmu.R8(m.PC)))
+    _ = m.sub(minuend, subtrahend, false)
+    m.PC += 1
+}
+
+// Subtract w/ Carry IND from A, flags:NZVC (A-59)
+func SBC_A2(m *M6800, mmu mem.MMU16) {
+    minuend := m.A
+    subtrahend := mmu.R8(m.X + uint16(mmu.R8(m.PC)))
+    m.A = m.sub(minuend, subtrahend, true)
+    m.PC += 1
+}
+
+// And A with IND, flags:NZV (A-6)
+func AND_A4(m *M6800, mmu mem.MMU16) {
+    m.A &= mmu.R8(m.X + uint16(mmu.R8(m.PC)))
+    m.CC &= ^V
+    m.set_NZ8(m.A)
+    m.PC += 1
+}
+
+// Bit A with IND, flags:NZV (A-15)
+func BIT_A5(m *M6800, mmu mem.MMU16) {
+    m.CC &= ^V
+    m.set_NZ8(m.A & mmu.R8(m.X + uint16(mmu.R8(m.PC))))
+    m.PC += 1
+}
+
 // Load A with IND, flags:NZV (A-45)
 func LDA_A6(m *M6800, mmu mem.MMU16) {
     addr := m.X + uint16(mmu.R8(m.PC))
@@ -1281,6 +1598,30 @@ func STA_A7(m *M6800, mmu mem.MMU16) {
     m.PC += 1
 }
 
+// Exclusive or IND to A, flags:NZV (A-39)
+func EOR_A8(m *M6800, mmu mem.MMU16) {
+    m.A ^= mmu.R8(m.X + uint16(mmu.R8(m.PC)))
+    m.CC &= ^V
+    m.set_NZ8(m.A)
+    m.PC += 1
+}
+
+// Add with carry IND to A, flags:HNZVC (A-4)
+func ADC_A9(m *M6800, mmu mem.MMU16) {
+    augend := m.A
+    addend := mmu.R8(m.X + uint16(mmu.R8(m.PC)))
+    m.A = m.add(augend, addend, true)
+    m.PC += 1
+}
+
+// OR IND to A, flags:NZV (A-51)
+func ORA_AA(m *M6800, mmu mem.MMU16) {
+    m.A |= mmu.R8(m.X + uint16(mmu.R8(m.PC)))
+    m.CC &= ^V
+    m.set_NZ8(m.A)
+    m.PC += 1
+}
+
 // Add without carry IND to A, flags:HNZVC (A-5)
 func ADD_AB(m *M6800, mmu mem.MMU16) {
     augend := m.A
@@ -1289,6 +1630,38 @@ func ADD_AB(m *M6800, mmu mem.MMU16) {
     m.PC += 1
 }
 
+// Compare IND from X, flags:NZV (A-33)
+func CPX_AC(m *M6800, mmu mem.MMU16) {
+    subtrahend := mmu.R16(m.X + uint16(mmu.R8(m.PC)))
+    difference := m.X - subtrahend
+
+    // overflow
+    msign := m.X & 0x8000 == 0x8000
+    ssign := subtrahend & 0x8000 == 0x8000
+    dsign := difference & 0x8000 == 0x8000
+    // false == positive, true == negative!
+    switch {
+        case !msign && ssign && dsign:
+            // positive - negative == negative
+            m.CC |= V
+        case msign && !ssign && !dsign:
+            // negative - positive == positive
+            m.CC |= V
+        default:
+            m.CC &= ^V
+    }
+    m.set_NZ16(difference)
+    // the 6801 and 6301 also set C on borrow
+    if m.Variant == MC6801 || m.Variant == HD6301 {
+        if m.X < subtrahend {
+            m.CC |= C
+        } else {
+            m.CC &= ^C
+        }
+    }
+    m.PC += 1
+}
+
 // Jump to subroutine IND, no flags (A-44)
 func JSR_AD(m *M6800, mmu mem.MMU16) {
     offset := mmu.R8(m.PC)
@@ -1298,6 +1671,30 @@ func JSR_AD(m *M6800, mmu mem.MMU16) {
     m.PC = m.X + uint16(offset)
 }
 
+// Load SP from IND, flags:NZV (A-46)
+func LDS_AE(m *M6800, mmu mem.MMU16) {
+    m.SP = mmu.R16(m.X + uint16(mmu.R8(m.PC)))
+    m.CC &= ^V
+    m.set_NZ16(m.SP)
+    m.PC += 1
+}
+
+// Store SP to IND, flags:NZV (A-64)
+func STS_AF(m *M6800, mmu mem.MMU16) {
+    mmu.W16(m.X + uint16(mmu.R8(m.PC)), m.SP)
+    m.CC &= ^V
+    m.set_NZ16(m.SP)
+    m.PC += 1
+}
+
+// Subtract EXT from A, flags:NZVC (A-66)
+func SUB_B0(m *M6800, mmu mem.MMU16) {
+    minuend := m.A
+    subtrahend := mmu.R8(mmu.R16(m.PC))
+    m.A = m.sub(minuend, subtrahend, false)
+    m.PC += 2
+}
+
 // Compare EXT from A, flags:NZVC (A-31)
 func CMP_B1(m *M6800, mmu mem.MMU16) {
     minuend := m.A
@@ -1306,6 +1703,14 @@ func CMP_B1(m *M6800, mmu mem.MMU16) {
     m.PC += 2
 }
 
+// Subtract w/ Carry EXT from A, flags:NZVC (A-59)
+func SBC_B2(m *M6800, mmu mem.MMU16) {
+    minuend := m.A
+    subtrahend := mmu.R8(mmu.R16(m.PC))
+    m.A = m.sub(minuend, subtrahend, true)
+    m.PC += 2
+}
+
 // And A with EXT, flags:NZV (A-6)
 func AND_B4(m *M6800, mmu mem.MMU16) {
     m.A &= mmu.R8(mmu.R16(m.PC))
@@ -1314,6 +1719,13 @@ func AND_B4(m *M6800, mmu mem.MMU16) {
     m.PC += 2
 }
 
+// Bit A with EXT, flags:NZV (A-15)
+func BIT_B5(m *M6800, mmu mem.MMU16) {
+    m.CC &= ^V
+    m.set_NZ8(m.A & mmu.R8(mmu.R16(m.PC)))
+    m.PC += 2
+}
+
 // Load A with EXT, flags:NZV (A-45)
 func LDA_B6(m *M6800, mmu mem.MMU16) {
     m.A = mmu.R8(mmu.R16(m.PC))
@@ -1346,6 +1758,14 @@ func ADC_B9(m *M6800, mmu mem.MMU16) {
     m.PC += 2
 }
 
+// OR EXT to A, flags:NZV (A-51)
+func ORA_BA(m *M6800, mmu mem.MMU16) {
+    m.A |= mmu.R8(mmu.R16(m.PC))
+    m.CC &= ^V
+    m.set_NZ8(m.A)
+    m.PC += 2
+}
+
 // Add without carry EXT to A, flags:HNZVC (A-5)
 func ADD_BB(m *M6800, mmu mem.MMU16) {
     augend := m.A
@@ -1375,16 +1795,40 @@ func CPX_BC(m *M6800, mmu mem.MMU16) {
             m.CC &= ^V
     }
     m.set_NZ16(difference)
+    // the 6801 and 6301 also set C on borrow
+    if m.Variant == MC6801 || m.Variant == HD6301 {
+        if m.X < subtrahend {
+            m.CC |= C
+        } else {
+            m.CC &= ^C
+        }
+    }
     m.PC += 2
 }
 
-// Jump to subroutine DIR, no flags (A-44)
+// Jump to subroutine EXT, no flags (A-44)
 func JSR_BD(m *M6800, mmu mem.MMU16) {
     mmu.W16(m.SP-1, m.PC+2)
     m.SP -= 2
     m.PC = mmu.R16(m.PC)
 }
 
+// Load SP from EXT, flags:NZV (A-46)
+func LDS_BE(m *M6800, mmu mem.MMU16) {
+    m.SP = mmu.R16(mmu.R16(m.PC))
+    m.CC &= ^V
+    m.set_NZ16(m.SP)
+    m.PC += 2
+}
+
+// Store SP to EXT, flags:NZV (A-64)
+func STS_BF(m *M6800, mmu mem.MMU16) {
+    mmu.W16(mmu.R16(m.PC), m.SP)
+    m.CC &= ^V
+    m.set_NZ16(m.SP)
+    m.PC += 2
+}
+
 // Subtract IMM from B, flags:NZVC (A-66)
 func SUB_C0(m *M6800, mmu mem.MMU16) {
     minuend := m.B
@@ -1504,6 +1948,13 @@ func AND_D4(m *M6800, mmu mem.MMU16) {
     m.PC += 1
 }
 
+// Bit B with DIR, flags:NZV (A-15)
+func BIT_D5(m *M6800, mmu mem.MMU16) {
+    m.CC &= ^V
+    m.set_NZ8(m.B & mmu.R8(uint16(mmu.R8(m.PC))))
+    m.PC += 1
+}
+
 // Load B with DIR, flags:NZV (A-45)
 func LDA_D6(m *M6800, mmu mem.MMU16) {
     m.B = mmu.R8(uint16(mmu.R8(m.PC)))
@@ -1536,6 +1987,14 @@ func ADC_D9(m *M6800, mmu mem.MMU16) {
     m.PC += 1
 }
 
+// OR DIR to B, flags:NZV (A-51)
+func ORA_DA(m *M6800, mmu mem.MMU16) {
+    m.B |= mmu.R8(uint16(mmu.R8(m.PC)))
+    m.CC &= ^V
+    m.set_NZ8(m.B)
+    m.PC += 1
+}
+
 // Add without carry DIR to B, flags:HNZVC (A-5)
 func ADD_DB(m *M6800, mmu mem.MMU16) {
     augend := m.B
@@ -1560,6 +2019,14 @@ func STX_DF(m *M6800, mmu mem.MMU16) {
     m.PC += 1
 }
 
+// Subtract IND from B, flags:NZVC (A-66)
+func SUB_E0(m *M6800, mmu mem.MMU16) {
+    minuend := m.B
+    subtrahend := mmu.R8(m.X + uint16(mmu.R8(m.PC)))
+    m.B = m.sub(minuend, subtrahend, false)
+    m.PC += 1
+}
+
 // Compare IND from B, flags:NZVC (A-31)
 func CMP_E1(m *M6800, mmu mem.MMU16) {
     minuend := m.B
@@ -1568,6 +2035,14 @@ func CMP_E1(m *M6800, mmu mem.MMU16) {
     m.PC += 1
 }
 
+// Subtract w/ Carry IND from B, flags:NZVC (A-59)
+func SBC_E2(m *M6800, mmu mem.MMU16) {
+    minuend := m.B
+    subtrahend := mmu.R8(m.X + uint16(mmu.R8(m.PC)))
+    m.B = m.sub(minuend, subtrahend, true)
+    m.PC += 1
+}
+
 // And B with IND, flags:NZV (A-6)
 func AND_E4(m *M6800, mmu mem.MMU16) {
     addr := m.X + uint16(mmu.R8(m.PC))
@@ -1601,6 +2076,30 @@ func STA_E7(m *M6800, mmu mem.MMU16) {
     m.PC += 1
 }
 
+// Exclusive or IND to B, flags:NZV (A-39)
+func EOR_E8(m *M6800, mmu mem.MMU16) {
+    m.B ^= mmu.R8(m.X + uint16(mmu.R8(m.PC)))
+    m.CC &= ^V
+    m.set_NZ8(m.B)
+    m.PC += 1
+}
+
+// Add with carry IND to B, flags:HNZVC (A-4)
+func ADC_E9(m *M6800, mmu mem.MMU16) {
+    augend := m.B
+    addend := mmu.R8(m.X + uint16(mmu.R8(m.PC)))
+    m.B = m.add(augend, addend, true)
+    m.PC += 1
+}
+
+// OR IND to B, flags:NZV (A-51)
+func ORA_EA(m *M6800, mmu mem.MMU16) {
+    m.B |= mmu.R8(m.X + uint16(mmu.R8(m.PC)))
+    m.CC &= ^V
+    m.set_NZ8(m.B)
+    m.PC += 1
+}
+
 // Add without carry IND to B, flags:HNZVC (A-5)
 func ADD_EB(m *M6800, mmu mem.MMU16) {
     augend := m.B
@@ -1641,6 +2140,29 @@ func CMP_F1(m *M6800, mmu mem.MMU16) {
     m.PC += 2
 }
 
+// Subtract w/ Carry EXT from B, flags:NZVC (A-59)
+func SBC_F2(m *M6800, mmu mem.MMU16) {
+    minuend := m.B
+    subtrahend := mmu.R8(mmu.R16(m.PC))
+    m.B = m.sub(minuend, subtrahend, true)
+    m.PC += 2
+}
+
+// And B with EXT, flags:NZV (A-6)
+func AND_F4(m *M6800, mmu mem.MMU16) {
+    m.B &= mmu.R8(mmu.R16(m.PC))
+    m.CC &= ^V
+    m.set_NZ8(m.B)
+    m.PC += 2
+}
+
+// Bit B with EXT, flags:NZV (A-15)
+func BIT_F5(m *M6800, mmu mem.MMU16) {
+    m.CC &= ^V
+    m.set_NZ8(m.B & mmu.R8(mmu.R16(m.PC)))
+    m.PC += 2
+}
+
 // Load B with EXT, flags:NZV (A-45)
 func LDA_F6(m *M6800, mmu mem.MMU16) {
     m.B = mmu.R8(mmu.R16(m.PC))
@@ -1657,6 +2179,30 @@ func STA_F7(m *M6800, mmu mem.MMU16) {
     m.PC += 2
 }
 
+// Exclusive or EXT to B, flags:NZV (A-39)
+func EOR_F8(m *M6800, mmu mem.MMU16) {
+    m.B ^= mmu.R8(mmu.R16(m.PC))
+    m.CC &= ^V
+    m.set_NZ8(m.B)
+    m.PC += 2
+}
+
+// Add with carry EXT to B, flags:HNZVC (A-4)
+func ADC_F9(m *M6800, mmu mem.MMU16) {
+    augend := m.B
+    addend := mmu.R8(mmu.R16(m.PC))
+    m.B = m.add(augend, addend, true)
+    m.PC += 2
+}
+
+// OR EXT to B, flags:NZV (A-51)
+func ORA_FA(m *M6800, mmu mem.MMU16) {
+    m.B |= mmu.R8(mmu.R16(m.PC))
+    m.CC &= ^V
+    m.set_NZ8(m.B)
+    m.PC += 2
+}
+
 // Add without carry EXT to B, flags:HNZVC (A-5)
 func ADD_FB(m *M6800, mmu mem.MMU16) {
     augend := m.B
@@ -1764,15 +2310,15 @@ func (m *M6800) add(augend, addend uint8, withcarry bool) uint8 {
     aughalf := augend & 0x08 == 0x08
     addhalf := addend & 0x08 == 0x08
     sumhalf := sum & 0x08 == 0x08
-    // half-carry if the following
-    // * both operands have bit 3 set (>7)
-    // * either operand has bit 3 clear (<8), but the sum doesn't (>7)  ???XXX???
+    // half-carry out of bit 3, same rule as the carry out of bit 7 above
+    // * both operands have bit 3 set
+    // * either operand has bit 3 set but the sum doesn't
     switch {
         case aughalf && addhalf:
             m.CC |= H
-        case !aughalf && sumhalf:
+        case addhalf && !sumhalf:
             m.CC |= H
-        case !addhalf && sumhalf:
+        case aughalf && !sumhalf:
             m.CC |= H
         default:
             m.CC &= ^H
@@ -1784,14 +2330,17 @@ func (m *M6800) add(augend, addend uint8, withcarry bool) uint8 {
 
 // common function to all SUB and CMP opcodes, handles NZVC flags
 func (m *M6800) sub(minuend, subtrahend uint8, withcarry bool) uint8 {
+    borrow := 0
     if withcarry && (m.CC & C == C) {
-        subtrahend += 1
+        borrow = 1
     }
 
-    difference := minuend + (^subtrahend + 1)
+    // done wide so that SBC of $FF with carry set still borrows
+    wide := int(minuend) - int(subtrahend) - borrow
+    difference := uint8(wide)
 
     // carry
-    if minuend < subtrahend {
+    if wide < 0 {
         m.CC |= C
     } else {
         m.CC &= ^C
@@ -0,0 +1,172 @@
+package m6800
+
+import (
+    "fmt"
+    "strings"
+)
+
+// Assembler source for the traced ROM, for patching and annotating.  Code
+// that's jumped or branched to gets a label (its symbol, or Lxxxx), symbols
+// that don't land on the start of a line become equs, and anything the
+// assembler couldn't turn back into the same bytes (undocumented and
+// NSC-8105-only opcodes) goes out as fcb with the instruction in a comment.
+
+// Source lines, assemble with Assemble or any Motorola-syntax 6800 assembler
+func (l *Listing) Asm() []string {
+    chunks := l.chunks()
+    starts := map[uint16]bool{}
+    for _, c := range chunks {
+        starts[c.addr] = true
+    }
+
+    // names for the starts of lines, symbols first
+    labels := map[uint16]string{}
+    for _, addr := range l.cpu.Symbols.Addrs() {
+        if starts[addr] {
+            labels[addr], _ = l.cpu.Symbols.Name(addr)
+        }
+    }
+    reference := func(addr uint16) {
+        if _, ok := labels[addr]; !ok && starts[addr] {
+            labels[addr] = fmt.Sprintf("L%.4X", addr)
+        }
+    }
+    for _, c := range chunks {
+        switch {
+            case c.kind == byte_opcode && c.inst.HasTarget:
+                reference(c.inst.Target)
+            case c.kind == byte_opcode && c.inst.Mode == Imw:
+                reference(c.inst.Operand)
+            case c.kind == byte_word:
+                reference(uint16(c.bytes[0])<<8 | uint16(c.bytes[1]))
+        }
+    }
+    name := func(addr uint16, format string) string {
+        if label, ok := labels[addr]; ok {
+            return label
+        }
+        if sym, ok := l.cpu.Symbols.Name(addr); ok {
+            return sym
+        }
+        return fmt.Sprintf(format, addr)
+    }
+
+    lines := []string{
+        fmt.Sprintf("; traced from the vectors by fpemu, %s", l.cpu.Variant),
+        "",
+    }
+    for _, addr := range l.cpu.Symbols.Addrs() {
+        if _, ok := labels[addr]; !ok {
+            sym, _ := l.cpu.Symbols.Name(addr)
+            lines = append(lines, asm_line(sym, "equ", fmt.Sprintf("$%.4X", addr), ""))
+        }
+    }
+    ops := l.cpu.opcodes()
+    next := -1
+    for _, c := range chunks {
+        if int(c.addr) != next {
+            lines = append(lines, "", asm_line("", "org", fmt.Sprintf("$%.4X", c.addr), ""))
+        }
+        next = int(c.addr) + len(c.bytes)
+        var instbytes string
+        for _, b := range c.bytes {
+            instbytes += fmt.Sprintf("%.2X", b)
+        }
+        comment := fmt.Sprintf("$%.4X  %s", c.addr, instbytes)
+        label := labels[c.addr]
+        if len(label) > 7 {
+            lines = append(lines, label + ":")
+            label = ""
+        }
+
+        var op, operand string
+        switch c.kind {
+            case byte_opcode:
+                inst := c.inst
+                op = asm_mnemonic(inst.Mnemonic)
+                switch inst.Mode {
+                    case Imb:
+                        operand = fmt.Sprintf("#$%.2X", inst.Operand)
+                    case Imw:
+                        operand = "#" + name(inst.Operand, "$%.4X")
+                    case Dir:
+                        operand = name(inst.Operand, "$%.2X")
+                    case Ext:
+                        operand = name(inst.Operand, "$%.4X")
+                        if inst.Operand < 0x100 {
+                            // would assemble as direct
+                            operand = ">" + operand
+                        }
+                    case Idx:
+                        operand = fmt.Sprintf("$%.2X,x", inst.Operand)
+                    case Rel:
+                        operand = name(inst.Target, "$%.4X")
+                    case Imx:
+                        operand = fmt.Sprintf("#$%.2X,$%.2X,x", inst.Bytes[1], inst.Bytes[2])
+                    case Imd:
+                        operand = fmt.Sprintf("#$%.2X,", inst.Bytes[1]) + name(inst.Target, "$%.2X")
+                }
+                if raw, ok := ops[opkey{op, inst.Mode}]; !ok || raw != inst.Opcode {
+                    comment += "  " + strings.TrimSpace(op + " " + operand)
+                    op, operand = "fcb", byte_list(c.bytes)
+                }
+            case byte_word:
+                op, operand = "fdb", name(uint16(c.bytes[0])<<8 | uint16(c.bytes[1]), "$%.4X")
+            default:
+                op, operand = "fcb", byte_list(c.bytes)
+        }
+        lines = append(lines, asm_line(label, op, operand, comment))
+    }
+    lines = append(lines, "", asm_line("", "end", "", ""))
+    return lines
+}
+
+func byte_list(bytes []uint8) string {
+    var out []string
+    for _, b := range bytes {
+        out = append(out, fmt.Sprintf("$%.2X", b))
+    }
+    return strings.Join(out, ",")
+}
+
+func asm_line(label, op, operand, comment string) string {
+    line := fmt.Sprintf("%-7s %-5s %s", label, op, operand)
+    if comment != "" {
+        line = fmt.Sprintf("%-32s; %s", line, comment)
+    }
+    return strings.TrimRight(line, " ")
+}
+
+// Assemble Asm() and compare it with the ROM, byte for byte
+func (l *Listing) Verify() error {
+    image, err := l.cpu.Assemble(strings.Join(l.Asm(), "\n"))
+    if err != nil {
+        return fmt.Errorf("reassembling: %v", err)
+    }
+    var diffs []string
+    count := 0
+    for addr := 0; addr < 1<<16; addr++ {
+        pc := uint16(addr)
+        val, assembled := image[pc]
+        var diff string
+        switch inrom := rom(l.mmu, pc); {
+            case inrom && !assembled:
+                diff = fmt.Sprintf("$%.4X missing", pc)
+            case !inrom && assembled:
+                diff = fmt.Sprintf("$%.4X isn't ROM", pc)
+            case inrom && val != l.mmu.Peek8(pc):
+                diff = fmt.Sprintf("$%.4X is 0x%.2X, ROM has 0x%.2X", pc, val, l.mmu.Peek8(pc))
+        }
+        if diff == "" {
+            continue
+        }
+        count += 1
+        if len(diffs) < 8 {
+            diffs = append(diffs, diff)
+        }
+    }
+    if count > 0 {
+        return fmt.Errorf("%d bytes differ after reassembling: %s", count, strings.Join(diffs, ", "))
+    }
+    return nil
+}
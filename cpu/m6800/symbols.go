@@ -0,0 +1,204 @@
+package m6800
+
+import (
+    "bufio"
+    "fmt"
+    "io"
+    "os"
+    "sort"
+    "strconv"
+    "strings"
+)
+
+// Names for addresses, substituted into the disassembly
+type Symbols struct {
+    names  map[uint16]string
+    addrs  map[string]uint16
+}
+
+// what every board has: the vectors, the PIA goes wherever the board puts it
+var builtin_symbols = []struct{ name string; addr uint16 }{
+    {"IRQ_VECTOR", 0xFFF8},
+    {"SWI_VECTOR", 0xFFFA},
+    {"NMI_VECTOR", 0xFFFC},
+    {"RESET_VECTOR", 0xFFFE},
+}
+
+// a PIA's registers by offset from its base
+var pia_registers = []string{
+    "PA",    // DDRA or ORA, depending on CRA bit 2, the DAC
+    "CRA",
+    "PB",    // DDRB or ORB, depending on CRB bit 2, the sound command
+    "CRB",
+}
+
+func NewSymbols() *Symbols {
+    return &Symbols{names:map[uint16]string{}, addrs:map[string]uint16{}}
+}
+
+// A table with just the built-in names
+func BuiltinSymbols() *Symbols {
+    s := NewSymbols()
+    for _, sym := range builtin_symbols {
+        s.Add(sym.name, sym.addr)
+    }
+    return s
+}
+
+// Name the registers of a PIA at base, prefix "PIA" gives PIA_PA..PIA_CRB
+func (s *Symbols) AddPIA(prefix string, base uint16) {
+    for i, reg := range pia_registers {
+        s.Add(prefix + "_" + reg, base + uint16(i))
+    }
+}
+
+// Name an address, replacing whatever name it had
+func (s *Symbols) Add(name string, addr uint16) {
+    if old, ok := s.names[addr]; ok {
+        delete(s.addrs, old)
+    }
+    s.names[addr] = name
+    s.addrs[name] = addr
+}
+
+// The name for addr, safe to call on a nil table
+func (s *Symbols) Name(addr uint16) (string, bool) {
+    if s == nil {
+        return "", false
+    }
+    name, ok := s.names[addr]
+    return name, ok
+}
+
+func (s *Symbols) Addr(name string) (uint16, bool) {
+    if s == nil {
+        return 0, false
+    }
+    addr, ok := s.addrs[name]
+    return addr, ok
+}
+
+func (s *Symbols) Len() int {
+    if s == nil {
+        return 0
+    }
+    return len(s.names)
+}
+
+// Every named address, in order
+func (s *Symbols) Addrs() []uint16 {
+    if s == nil {
+        return nil
+    }
+    var addrs []uint16
+    for addr := range s.names {
+        addrs = append(addrs, addr)
+    }
+    sort.Slice(addrs, func(i, j int) bool { return addrs[i] < addrs[j] })
+    return addrs
+}
+
+func (s *Symbols) LoadFile(path string) error {
+    fh, err := os.Open(path)
+    if err != nil {
+        return err
+    }
+    defer fh.Close()
+    if err := s.Load(fh); err != nil {
+        return fmt.Errorf("%s: %v", path, err)
+    }
+    return nil
+}
+
+// Read symbols, one per line, in any of
+//
+//     reset = $F800          plain, the value can also be 0xF800 or F800
+//     reset  =  F800  GR     asxxxx .sym
+//     reset  F800            asxxxx .sym, no "="
+//     F800  reset            MAME, and the asxxxx .map "Value Global" lines
+//
+// An address that comes first has to be at least 4 hex digits, so it isn't
+// taken for a name.  ";", "#" and "//" start comments, and lines that aren't
+// symbols, like the headers in a .map file, are skipped.
+func (s *Symbols) Load(r io.Reader) error {
+    scanner := bufio.NewScanner(r)
+    found := 0
+    for scanner.Scan() {
+        line := scanner.Text()
+        for _, comment := range []string{";", "#", "//"} {
+            if i := strings.Index(line, comment); i > -1 {
+                line = line[:i]
+            }
+        }
+        var name, value string
+        if i := strings.IndexByte(line, '='); i > -1 {
+            left, right := strings.Fields(line[:i]), strings.Fields(line[i+1:])
+            if len(left) != 1 || len(right) == 0 {
+                continue
+            }
+            name, value = left[0], right[0]
+        } else {
+            fields := strings.Fields(line)
+            if len(fields) < 2 {
+                continue
+            }
+            if address_first(fields[0]) && symbol_name(fields[1]) {
+                name, value = fields[1], fields[0]
+            } else {
+                name, value = fields[0], fields[1]
+            }
+        }
+        addr, ok := parse_symaddr(value)
+        if !ok || !symbol_name(name) {
+            continue
+        }
+        s.Add(name, addr)
+        found += 1
+    }
+    if err := scanner.Err(); err != nil {
+        return err
+    }
+    if found == 0 {
+        return fmt.Errorf("no symbols found")
+    }
+    return nil
+}
+
+// $F800, 0xF800 or F800, anything past 16 bits is an error
+func parse_symaddr(value string) (uint16, bool) {
+    switch {
+        case strings.HasPrefix(value, "$"):
+            value = value[1:]
+        case strings.HasPrefix(value, "0x"), strings.HasPrefix(value, "0X"):
+            value = value[2:]
+    }
+    addr, err := strconv.ParseUint(value, 16, 16)
+    if err != nil {
+        return 0, false
+    }
+    return uint16(addr), true
+}
+
+// "$F800" or "0xF800", or bare hex that's too long to be a name
+func address_first(field string) bool {
+    if _, ok := parse_symaddr(field); !ok {
+        return false
+    }
+    return field[0] == '$' || strings.HasPrefix(field, "0x") || strings.HasPrefix(field, "0X") || len(field) >= 4
+}
+
+// letters, digits, "_" and "." (asxxxx local and area names), not starting
+// with a digit
+func symbol_name(name string) bool {
+    if name == "" || (name[0] >= '0' && name[0] <= '9') {
+        return false
+    }
+    for _, r := range name {
+        switch {
+            case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '.':
+            default:
+                return false
+        }
+    }
+    return true
+}
@@ -0,0 +1,94 @@
+package m6800
+
+import (
+    "strings"
+    "testing"
+
+    "github.com/bartgrantham/fpemu/mem/d8224"
+    "github.com/bartgrantham/fpemu/pia/m6821"
+)
+
+func TestSymbolsLoad(t *testing.T) {
+    file := `
+; plain
+reset = $F800
+irq = 0xF80C       ; handler
+; asxxxx .sym
+    dispatch       =  F81A  GR
+    clra_cmd          F81E  R
+; asxxxx .map
+Hexadecimal  [16-Bits]
+Area                    Addr        Size        Decimal Bytes (Attributes)
+--------------------    ----        ----        ------- ----- ------------
+_CODE                   F800        0022 =          34. bytes (REL,CON)
+
+      Value  Global
+   --------  --------------------------------
+       F820  clrb_cmd
+# MAME
+00F804 idle
+`
+    syms := NewSymbols()
+    if err := syms.Load(strings.NewReader(file)); err != nil {
+        t.Fatal(err)
+    }
+    want := map[string]uint16{"reset":0xF800, "irq":0xF80C, "dispatch":0xF81A, "clra_cmd":0xF81E, "clrb_cmd":0xF820, "idle":0xF804}
+    for name, addr := range want {
+        if got, ok := syms.Addr(name); !ok || got != addr {
+            t.Errorf("%s is $%.4X (%v), want $%.4X", name, got, ok, addr)
+        }
+    }
+    if syms.Len() != len(want) {
+        t.Errorf("%d symbols, want %d", syms.Len(), len(want))
+    }
+    if err := NewSymbols().Load(strings.NewReader("nothing here\n")); err == nil {
+        t.Errorf("a file without symbols loaded")
+    }
+}
+
+func TestSymbolsPIA(t *testing.T) {
+    syms := BuiltinSymbols()
+    if _, ok := syms.Addr("PIA_PA"); ok {
+        t.Errorf("the built-in names have a PIA, the board places it")
+    }
+    syms.AddPIA("PIA", 0x2000)
+    syms.AddPIA("PIA2", 0x4000)
+    for name, addr := range map[string]uint16{"PIA_PA":0x2000, "PIA_CRB":0x2003, "PIA2_CRA":0x4001} {
+        if got, ok := syms.Addr(name); !ok || got != addr {
+            t.Errorf("%s is $%.4X (%v), want $%.4X", name, got, ok, addr)
+        }
+    }
+}
+
+func TestSymbolsInDisasm(t *testing.T) {
+    rom := make([]uint8, 0x800)
+    copy(rom, dispatcher)
+    rom[0x7F8], rom[0x7F9] = 0xF8, 0x0C
+    rom[0x7FE], rom[0x7FF] = 0xF8, 0x00
+    pia := &m6821.M6821{}
+    mmu := d8224.NewD8224Mem(pia)
+    if err := mmu.Mount(0xF800, rom, false); err != nil {
+        t.Fatal(err)
+    }
+    m := NewM6800(mmu, pia)
+    m.Symbols.Add("idle", 0xF804)
+    m.Symbols.Add("dispatch", 0xF81A)
+    m.Symbols.Add("clra_cmd", 0xF81E)
+
+    if line, _ := m.Disasm(0xF805, mmu); !strings.Contains(line, "bra   idle ($F805+2 - 3)") {
+        t.Errorf("branch isn't labeled: %q", line)
+    }
+    if line, _ := m.Disasm(0xF80C, mmu); !strings.Contains(line, "ldx   dispatch") {
+        t.Errorf("immediate address isn't labeled: %q", line)
+    }
+    text := strings.Join(m.DisasmTrace(mmu).Lines(), "\n")
+    for _, want := range []string{
+        "idle:\n0xF804    3E        wai",
+        "dispatch:\n0xF81A    F81E      fdb   clra_cmd",
+        "RESET_VECTOR:\n0xFFFE    F800      fdb   $F800",
+    } {
+        if !strings.Contains(text, want) {
+            t.Errorf("listing is missing %q", want)
+        }
+    }
+}
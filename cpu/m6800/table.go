@@ -29,12 +29,12 @@ var M6800Ops [260]OpcodeDesc = [260]OpcodeDesc{
     {"inx", Inh, 0}, {"dex", Inh, 0}, {"clv", Inh, 0}, {"sev", Inh, 0},
     {"clc", Inh, 0}, {"sec", Inh, 0}, {"cli", Inh, 0}, {"sei", Inh, 0},
 // 10
-    {"sba", Inh, 0}, {"cba", Inh, 0}, {"asx1", Sx1, 0}, {"asx2", Sx1, 0},
+    {"sba", Inh, 0}, {"cba", Inh, 0}, {"asx1", Sx1, 3}, {"asx2", Sx1, 3},
     {"ill", Inh, 7}, {"ill", Inh, 7}, {"tab", Inh, 0}, {"tba", Inh, 0},
-    {"xgdx", Inh, 3}, {"daa", Inh, 0}, {"ill", Inh, 7}, {"aba", Inh, 0},
+    {"xgdx", Inh, 3}, {"daa", Inh, 0}, {"slp", Inh, 3}, {"aba", Inh, 0},
     {"ill", Inh, 7}, {"ill", Inh, 7}, {"ill", Inh, 7}, {"ill", Inh, 7},
 // 20
-    {"bra", Rel, 0}, {"brn", Rel, 0}, {"bhi", Rel, 0}, {"bls", Rel, 0},
+    {"bra", Rel, 0}, {"brn", Rel, 1}, {"bhi", Rel, 0}, {"bls", Rel, 0},
     {"bcc", Rel, 0}, {"bcs", Rel, 0}, {"bne", Rel, 0}, {"beq", Rel, 0},
     {"bvc", Rel, 0}, {"bvs", Rel, 0}, {"bpl", Rel, 0}, {"bmi", Rel, 0},
     {"bge", Rel, 0}, {"blt", Rel, 0}, {"bgt", Rel, 0}, {"ble", Rel, 0},
@@ -72,7 +72,7 @@ var M6800Ops [260]OpcodeDesc = [260]OpcodeDesc{
     {"suba", Dir, 0}, {"cmpa", Dir, 0}, {"sbca", Dir, 0}, {"subd", Dir, 1},
     {"anda", Dir, 0}, {"bita", Dir, 0}, {"lda", Dir, 0}, {"sta", Dir, 0},
     {"eora", Dir, 0}, {"adca", Dir, 0}, {"ora", Dir, 0}, {"adda", Dir, 0},
-    {"cmpx", Dir, 0}, {"jsr", Dir, 0}, {"lds", Dir, 0}, {"sts", Dir, 0},
+    {"cmpx", Dir, 0}, {"jsr", Dir, 1}, {"lds", Dir, 0}, {"sts", Dir, 0},
 // a0
     {"suba", Idx, 0}, {"cmpa", Idx, 0}, {"sbca", Idx, 0}, {"subd", Idx, 1},
     {"anda", Idx, 0}, {"bita", Idx, 0}, {"lda", Idx, 0}, {"sta", Idx, 0},
@@ -103,6 +103,6 @@ var M6800Ops [260]OpcodeDesc = [260]OpcodeDesc{
     {"andb", Ext, 0}, {"bitb", Ext, 0}, {"ldb", Ext, 0}, {"stb", Ext, 0},
     {"eorb", Ext, 0}, {"adcb", Ext, 0}, {"orb", Ext, 0}, {"addb", Ext, 0},
     {"ldd", Ext, 1}, {"_std", Ext, 1}, {"ldx", Ext, 0}, {"stx", Ext, 0},
-// NSC-8105 alternate instructions: 0xfc, 0xec, 0xbb, 0xb2
+// NSC-8105 alternate instructions, raw 0xfc, 0xec, 0xbb, 0xb2 (unscrambled 0xfc, 0xec, 0x7b, 0x71)
     {"addx", Ext, 0}, {"adcx", Imb, 0}, {"bitx", Imx, 0}, {"stx", Imx, 0},
 }
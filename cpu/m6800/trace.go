@@ -0,0 +1,254 @@
+package m6800
+
+import (
+    "fmt"
+
+    "github.com/bartgrantham/fpemu/mem"
+)
+
+// Tracing disassembly
+// Rather than disassembling every byte, start from the interrupt vectors and
+// follow the flow of control: branches both ways, JSR/BSR into the
+// subroutine and back out, JMP only to its target.  Whatever the flow never
+// reaches is data.  Jumps through X can't be followed in general, but the
+// sound ROMs dispatch with
+//
+//     ldx   #table
+//     ...               X += 2*index
+//     ldx   0,x
+//     jmp   0,x
+//
+// so a "ldx n,x" just before an indexed jump marks a table of pointers at the
+// last "ldx #", and its entries are followed too.
+
+// what the trace decided each byte is
+const (
+    byte_data = iota  // not reached, shown as fcb
+    byte_opcode
+    byte_operand
+    byte_word         // high byte of a pointer, shown as fdb
+    byte_wordlow
+)
+
+const max_jumptable = 64
+
+type Listing struct {
+    cpu      *M6800
+    mmu      mem.MMU16
+    kind     [1<<16]uint8
+    Entries  []uint16  // where the trace started, from the vectors and jump tables
+    tables   map[uint16][]uint16  // indexed jumps, and the jump table entries they go through
+}
+
+// 6800 vectors, the 6801/6301 have more below these
+var trace_vectors = map[Variant][]uint16{
+    MC6800:  {0xFFF8, 0xFFFA, 0xFFFC, 0xFFFE},
+    MC6801:  {0xFFF0, 0xFFF2, 0xFFF4, 0xFFF6, 0xFFF8, 0xFFFA, 0xFFFC, 0xFFFE},
+    HD6301:  {0xFFEE, 0xFFF0, 0xFFF2, 0xFFF4, 0xFFF6, 0xFFF8, 0xFFFA, 0xFFFC, 0xFFFE},
+    NSC8105: {0xFFF8, 0xFFFA, 0xFFFC, 0xFFFE},
+}
+
+// only ROM is worth tracing, RAM contents are whatever they were at startup,
+// and a mirror of ROM is listed where it's mounted
+func rom(mmu mem.MMU16, addr uint16) bool {
+    if m, ok := mmu.(interface{ Mirror(uint16) (uint16, bool) }); ok {
+        if _, mirror := m.Mirror(addr); mirror {
+            return false
+        }
+    }
+    r, w := mmu.Valid(addr)
+    return r && !w
+}
+
+// Trace the code reachable from the vectors
+func (c *M6800) DisasmTrace(mmu mem.MMU16) *Listing {
+    l := &Listing{cpu:c, mmu:mmu, tables:map[uint16][]uint16{}}
+    var pending []uint16
+    for _, vector := range trace_vectors[c.Variant] {
+        if !rom(mmu, vector) || !rom(mmu, vector+1) {
+            continue
+        }
+        l.kind[vector], l.kind[vector+1] = byte_word, byte_wordlow
+        pending = append(pending, mmu.R16(vector))
+    }
+    for len(pending) > 0 {
+        pc := pending[len(pending)-1]
+        pending = pending[:len(pending)-1]
+        if !rom(mmu, pc) || l.kind[pc] != byte_data {
+            continue
+        }
+        l.Entries = append(l.Entries, pc)
+        pending = append(pending, l.flow(pc)...)
+    }
+    return l
+}
+
+// follow straight-line code from pc, returning where else it can go
+func (l *Listing) flow(pc uint16) (targets []uint16) {
+    mmu := l.mmu
+    var table uint16
+    var havetable, loadindexed bool
+    var loadoffset uint8
+    for rom(mmu, pc) && l.kind[pc] == byte_data {
+        inst := l.cpu.Decode(pc, mmu)
+        if !inst.Legal {
+            return targets
+        }
+        length := inst.Len()
+        for i := uint16(1); i < length; i++ {
+            if !rom(mmu, pc+i) || l.kind[pc+i] != byte_data {
+                // runs into something already decoded, or off the end
+                return targets
+            }
+        }
+        l.kind[pc] = byte_opcode
+        for i := uint16(1); i < length; i++ {
+            l.kind[pc+i] = byte_operand
+        }
+        switch inst.Mnemonic {
+            case "brn":
+            case "jmp", "jsr":
+                if inst.HasTarget {
+                    targets = append(targets, inst.Target)
+                } else if havetable && loadindexed {
+                    l.tables[pc] = l.jumptable(table + uint16(loadoffset))
+                    targets = append(targets, l.tables[pc]...)
+                }
+                if inst.Mnemonic == "jmp" {
+                    return targets
+                }
+            case "rts", "rti", "hcf":
+                return targets
+            default:
+                if inst.Mode == Rel {
+                    targets = append(targets, inst.Target)
+                    if inst.Mnemonic == "bra" {
+                        return targets
+                    }
+                }
+        }
+        // the jump table pattern, reset by anything else that loads X
+        loadindexed = false
+        if inst.Mnemonic == "ldx" {
+            switch inst.Mode {
+                case Imw:
+                    table = inst.Operand
+                    havetable = true
+                case Idx:
+                    loadoffset = uint8(inst.Operand)
+                    loadindexed = true
+                default:
+                    havetable = false
+            }
+        }
+        pc += length
+    }
+    return targets
+}
+
+// mark the pointers at addr as data and return them, the table ends at the
+// first entry that isn't a ROM address or overlaps something already decoded
+func (l *Listing) jumptable(addr uint16) (targets []uint16) {
+    for i := 0; i < max_jumptable; i++ {
+        if !rom(l.mmu, addr) || !rom(l.mmu, addr+1) || l.kind[addr] != byte_data || l.kind[addr+1] != byte_data {
+            break
+        }
+        target := uint16(l.mmu.Peek8(addr))<<8 | uint16(l.mmu.Peek8(addr+1))
+        if !rom(l.mmu, target) {
+            break
+        }
+        l.kind[addr], l.kind[addr+1] = byte_word, byte_wordlow
+        targets = append(targets, target)
+        addr += 2
+    }
+    return targets
+}
+
+// Whether addr is the first byte of a traced instruction
+func (l *Listing) IsCode(addr uint16) bool {
+    return l.kind[addr] == byte_opcode
+}
+
+// a line of the listing: one instruction, one pointer, or a run of bytes
+type chunk struct {
+    addr   uint16
+    kind   uint8        // byte_opcode, byte_word or byte_data
+    bytes  []uint8
+    inst   Instruction  // for byte_opcode
+}
+
+// split the ROM into chunks, in address order
+func (l *Listing) chunks() []chunk {
+    var chunks []chunk
+    for addr := 0; addr < 1<<16; {
+        pc := uint16(addr)
+        if !rom(l.mmu, pc) {
+            addr += 1
+            continue
+        }
+        switch l.kind[pc] {
+            case byte_opcode:
+                inst := l.cpu.Decode(pc, l.mmu)
+                chunks = append(chunks, chunk{pc, byte_opcode, inst.Bytes, inst})
+                addr += int(inst.Len())
+                continue
+            case byte_word:
+                if addr+1 < 1<<16 && l.kind[pc+1] == byte_wordlow {
+                    chunks = append(chunks, chunk{addr:pc, kind:byte_word, bytes:[]uint8{l.mmu.Peek8(pc), l.mmu.Peek8(pc+1)}})
+                    addr += 2
+                    continue
+                }
+        }
+        // up to 4 bytes a line, stopping at anything that isn't plain data or
+        // has a label
+        c := chunk{addr:pc, kind:byte_data}
+        for n := 0; n < 4 && addr < 1<<16; n++ {
+            at := uint16(addr)
+            _, named := l.cpu.Symbols.Name(at)
+            if n > 0 && (l.kind[at] != byte_data || !rom(l.mmu, at) || named) {
+                break
+            }
+            c.bytes = append(c.bytes, l.mmu.Peek8(at))
+            addr += 1
+        }
+        chunks = append(chunks, c)
+    }
+    return chunks
+}
+
+// The listing, in address order: traced instructions as Disasm shows them,
+// jump tables and vectors as fdb, and every other byte of ROM as fcb, with a
+// "name:" line before each address that has a symbol
+func (l *Listing) Lines() []string {
+    var lines []string
+    for _, c := range l.chunks() {
+        if name, ok := l.cpu.Symbols.Name(c.addr); ok {
+            lines = append(lines, name + ":")
+        }
+        var instbytes, desc string
+        for _, b := range c.bytes {
+            instbytes += fmt.Sprintf("%.2X", b)
+        }
+        switch c.kind {
+            case byte_opcode:
+                lines = append(lines, c.inst.String())
+                continue
+            case byte_word:
+                word := uint16(c.bytes[0])<<8 | uint16(c.bytes[1])
+                desc = fmt.Sprintf("fdb   $%.4X", word)
+                if name, ok := l.cpu.Symbols.Name(word); ok {
+                    desc = "fdb   " + name
+                }
+            default:
+                desc = "fcb   "
+                for i, b := range c.bytes {
+                    if i > 0 {
+                        desc += ","
+                    }
+                    desc += fmt.Sprintf("$%.2X", b)
+                }
+        }
+        lines = append(lines, fmt.Sprintf("0x%.4X    %-8s  %s", c.addr, instbytes, desc))
+    }
+    return lines
+}
@@ -0,0 +1,73 @@
+package m6800
+
+import (
+    "strings"
+    "testing"
+
+    "github.com/bartgrantham/fpemu/mem/d8224"
+    "github.com/bartgrantham/fpemu/pia/m6821"
+)
+
+// a command dispatcher in the style of the sound ROMs, with a string and a
+// jump table in among the code
+var dispatcher = []uint8{
+    0x8E, 0x00, 0x7F,        // F800  lds   #$007F
+    0x0E,                    // F803  cli
+    0x3E,                    // F804  wai
+    0x20, 0xFD,              // F805  bra   $F804
+    0x48, 0x45, 0x4C, 0x4C,  // F807  fcc   "HELL"     never reached
+    0x4F,                    // F80B  fcb   'O'
+    0xCE, 0xF8, 0x1A,        // F80C  ldx   #$F81A    IRQ
+    0x08,                    // F80F  inx
+    0x08,                    // F810  inx
+    0x4A,                    // F811  deca
+    0x26, 0xFB,              // F812  bne   $F80F
+    0xEE, 0x00,              // F814  ldx   0,x
+    0xAD, 0x00,              // F816  jsr   0,x
+    0x3B,                    // F818  rti
+    0x01,                    // F819  fcb   $01        padding
+    0xF8, 0x1E,              // F81A  fdb   $F81E
+    0xF8, 0x20,              // F81C  fdb   $F820
+    0x4F,                    // F81E  clra
+    0x39,                    // F81F  rts
+    0x5F,                    // F820  clrb
+    0x39,                    // F821  rts
+}
+
+func TestDisasmTrace(t *testing.T) {
+    rom := make([]uint8, 0x800)
+    copy(rom, dispatcher)
+    rom[0x7F8], rom[0x7F9] = 0xF8, 0x0C  // IRQ
+    rom[0x7FE], rom[0x7FF] = 0xF8, 0x00  // RESET
+    pia := &m6821.M6821{}
+    mmu := d8224.NewD8224Mem(pia)
+    if err := mmu.Mount(0xF800, rom, false); err != nil {
+        t.Fatal(err)
+    }
+    m := NewM6800(mmu, pia)
+    listing := m.DisasmTrace(mmu)
+
+    for _, addr := range []uint16{0xF800, 0xF804, 0xF805, 0xF80C, 0xF816, 0xF818, 0xF81E, 0xF820, 0xF821} {
+        if !listing.IsCode(addr) {
+            t.Errorf("$%.4X should be code", addr)
+        }
+    }
+    for _, addr := range []uint16{0xF807, 0xF80B, 0xF819, 0xF81A, 0xF81C, 0xF822, 0xFFF8} {
+        if listing.IsCode(addr) {
+            t.Errorf("$%.4X shouldn't be code", addr)
+        }
+    }
+
+    text := strings.Join(listing.Lines(), "\n")
+    for _, want := range []string{
+        "0xF807    48454C4C  fcb   $48,$45,$4C,$4C",
+        "0xF81A    F81E      fdb   $F81E",
+        "0xF81C    F820      fdb   $F820",
+        "0xFFFE    F800      fdb   $F800",
+        "0xF820    5F        clrb",
+    } {
+        if !strings.Contains(text, want) {
+            t.Errorf("listing is missing %q", want)
+        }
+    }
+}
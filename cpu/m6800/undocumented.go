@@ -0,0 +1,151 @@
+package m6800
+
+import (
+    "github.com/bartgrantham/fpemu/mem"
+)
+
+// What NMOS 6800/6802 silicon does with some of the opcodes Motorola left out,
+// only used with M6800.Undocumented set on an MC6800.  From decapping/logic-
+// analyzer write-ups of the part, the read-modify-write rows $40-$7F decode
+// ignoring bit 0, so $x1, $x5, $xB and $4E/$5E run as $x0, $x4, $xA and
+// $4F/$5F, and $x2 uses bit 1 for "complement instead of negate if C is set".
+//
+// Emulated: $14/$15 (NBA), $41/$51/$61/$71, $42/$52/$62/$72 (NGC),
+// $45/$55/$65/$75, $4B/$5B/$6B/$7B, $4E/$5E, $87/$C7/$8F/$CF (store
+// "immediate") and $9D/$DD (HCF).  Everything else Motorola left out ($00,
+// $02, $03, $12, $13, $18, $1A, $1C-$1F, $38, $3A, $3C, $3D, $83, $93, $A3,
+// $B3, $C3, $CC, $CD, $D3, $DC, $E3, $EC, $ED, $F3, $FC, $FD) stays illegal.
+
+var cyclecounts_undoc [256]int
+var dispatch_undoc [256]func(*M6800, mem.MMU16)
+
+// disassembly for the slots the table has as "ill"
+var undocumented_ops = map[uint8]OpcodeDesc{
+    0x14:{"nba", Inh, 0}, 0x15:{"nba", Inh, 0},
+    0x41:{"neg", Inh, 0}, 0x51:{"neg", Inh, 0}, 0x61:{"neg", Idx, 0}, 0x71:{"neg", Ext, 0},
+    0x42:{"ngc", Inh, 0}, 0x52:{"ngc", Inh, 0}, 0x62:{"ngc", Idx, 0}, 0x72:{"ngc", Ext, 0},
+    0x45:{"lsra", Inh, 0}, 0x55:{"lsrb", Inh, 0}, 0x65:{"lsr", Idx, 0}, 0x75:{"lsr", Ext, 0},
+    0x4B:{"deca", Inh, 0}, 0x5B:{"decb", Inh, 0}, 0x6B:{"dec", Idx, 0}, 0x7B:{"dec", Ext, 0},
+    0x4E:{"clra", Inh, 0}, 0x5E:{"clrb", Inh, 0},
+    0x87:{"sta", Imb, 0}, 0xC7:{"stb", Imb, 0}, 0x8F:{"sts", Imw, 0}, 0xCF:{"stx", Imw, 0},
+    0x9D:{"hcf", Inh, 0}, 0xDD:{"hcf", Inh, 0},
+}
+
+func init() {
+    dispatch_undoc = dispatch_table
+    cyclecounts_undoc = cyclecounts
+    for opcode, op := range map[uint8]struct{ fn func(*M6800, mem.MMU16); cycles int }{
+        0x14:{NBA_14, 2}, 0x15:{NBA_14, 2},
+        0x41:{NEG_40, 2}, 0x51:{NEG_50, 2}, 0x61:{NEG_60, 7}, 0x71:{NEG_70, 6},
+        0x42:{NGC_42, 2}, 0x52:{NGC_52, 2}, 0x62:{NGC_62, 7}, 0x72:{NGC_72, 6},
+        0x45:{LSR_44, 2}, 0x55:{LSR_54, 2}, 0x65:{LSR_64, 7}, 0x75:{LSR_74, 6},
+        0x4B:{DEC_4A, 2}, 0x5B:{DEC_5A, 2}, 0x6B:{DEC_6A, 7}, 0x7B:{DEC_7A, 6},
+        0x4E:{CLR_4F, 2}, 0x5E:{CLR_5F, 2},
+        0x87:{STA_87, 4}, 0xC7:{STA_C7, 4}, 0x8F:{STS_8F, 5}, 0xCF:{STX_CF, 5},
+        0x9D:{HCF_9D, 1}, 0xDD:{HCF_9D, 1},
+    } {
+        dispatch_undoc[opcode] = op.fn
+        cyclecounts_undoc[opcode] = op.cycles
+    }
+}
+
+// the tables Step and Exec dispatch through
+func (m *M6800) tables() (*[256]func(*M6800, mem.MMU16), *[256]int) {
+    if m.Undocumented && m.Variant == MC6800 {
+        return &dispatch_undoc, &cyclecounts_undoc
+    }
+    v := &variants[m.Variant]
+    return v.ops, v.cycles
+}
+
+// the description of an undocumented opcode, if it runs as one
+func (m *M6800) undocumented(opcode uint8) (OpcodeDesc, bool) {
+    if !m.Undocumented || m.Variant != MC6800 {
+        return OpcodeDesc{}, false
+    }
+    desc, ok := undocumented_ops[opcode]
+    return desc, ok
+}
+
+// And B into A, undocumented, flags:NZV
+func NBA_14(m *M6800, mmu mem.MMU16) {
+    m.A &= m.B
+    m.CC &= ^V
+    m.set_NZ8(m.A)
+}
+
+// Negate A, or complement it if C is set, undocumented, flags:NZVC
+func NGC_42(m *M6800, mmu mem.MMU16) {
+    if m.CC & C == C {
+        COM_43(m, mmu)
+    } else {
+        NEG_40(m, mmu)
+    }
+}
+
+// Negate B, or complement it if C is set, undocumented, flags:NZVC
+func NGC_52(m *M6800, mmu mem.MMU16) {
+    if m.CC & C == C {
+        COM_53(m, mmu)
+    } else {
+        NEG_50(m, mmu)
+    }
+}
+
+// Negate IND, or complement it if C is set, undocumented, flags:NZVC
+func NGC_62(m *M6800, mmu mem.MMU16) {
+    if m.CC & C == C {
+        COM_63(m, mmu)
+    } else {
+        NEG_60(m, mmu)
+    }
+}
+
+// Negate EXT, or complement it if C is set, undocumented, flags:NZVC
+func NGC_72(m *M6800, mmu mem.MMU16) {
+    if m.CC & C == C {
+        COM_73(m, mmu)
+    } else {
+        NEG_70(m, mmu)
+    }
+}
+
+// Store A "immediate", undocumented, flags:NZV
+// writes over its own operand byte, which in ROM does nothing
+func STA_87(m *M6800, mmu mem.MMU16) {
+    mmu.W8(m.PC, m.A)
+    m.CC &= ^V
+    m.set_NZ8(m.A)
+    m.PC += 1
+}
+
+// Store B "immediate", undocumented, flags:NZV
+func STA_C7(m *M6800, mmu mem.MMU16) {
+    mmu.W8(m.PC, m.B)
+    m.CC &= ^V
+    m.set_NZ8(m.B)
+    m.PC += 1
+}
+
+// Store SP "immediate", undocumented, flags:NZV
+func STS_8F(m *M6800, mmu mem.MMU16) {
+    mmu.W16(m.PC, m.SP)
+    m.CC &= ^V
+    m.set_NZ16(m.SP)
+    m.PC += 2
+}
+
+// Store X "immediate", undocumented, flags:NZV
+func STX_CF(m *M6800, mmu mem.MMU16) {
+    mmu.W16(m.PC, m.X)
+    m.CC &= ^V
+    m.set_NZ16(m.X)
+    m.PC += 2
+}
+
+// Halt and Catch Fire, undocumented, the address bus counts up forever and
+// nothing but RESET gets the CPU out, interrupts included
+func HCF_9D(m *M6800, mmu mem.MMU16) {
+    m.PC -= 1
+    m.Fault = ErrHCF{PC:m.PC, Opcode:m.op, CPU:m.Registers}
+}
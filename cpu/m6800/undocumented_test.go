@@ -0,0 +1,83 @@
+package m6800
+
+import (
+    "testing"
+)
+
+func TestUndocumented(t *testing.T) {
+    tests := []struct {
+        name     string
+        code     []uint8
+        initial  Registers
+        final    Registers
+        cycles   int
+        ram      map[uint16]uint8
+    }{
+        {"41 neg", []uint8{0x41}, Registers{PC:0x1000, A:0x01}, Registers{PC:0x1001, A:0xFF, CC:N|C}, 2, nil},
+        {"52 ngc C clear", []uint8{0x52}, Registers{PC:0x1000, B:0x01}, Registers{PC:0x1001, B:0xFF, CC:N|C}, 2, nil},
+        {"52 ngc C set", []uint8{0x52}, Registers{PC:0x1000, B:0x01, CC:C}, Registers{PC:0x1001, B:0xFE, CC:N|C}, 2, nil},
+        // unwritten memory reads as 0
+        {"72 ngc ext", []uint8{0x72, 0x20, 0x00}, Registers{PC:0x1000, CC:C}, Registers{PC:0x1003, CC:N|C}, 6, map[uint16]uint8{0x2000:0xFF}},
+        {"15 nba", []uint8{0x15}, Registers{PC:0x1000, A:0xF0, B:0x9C, CC:V}, Registers{PC:0x1001, A:0x90, B:0x9C, CC:N}, 2, nil},
+        {"45 lsr", []uint8{0x45}, Registers{PC:0x1000, A:0x03}, Registers{PC:0x1001, A:0x01, CC:C|V}, 2, nil},
+        {"65 lsr ind", []uint8{0x65, 0x10}, Registers{PC:0x1000, X:0x2000}, Registers{PC:0x1002, X:0x2000, CC:Z}, 7, map[uint16]uint8{0x2010:0x00}},
+        {"5B dec", []uint8{0x5B}, Registers{PC:0x1000, B:0x80}, Registers{PC:0x1001, B:0x7F, CC:V}, 2, nil},
+        {"7B dec ext", []uint8{0x7B, 0x20, 0x00}, Registers{PC:0x1000}, Registers{PC:0x1003, CC:N}, 6, map[uint16]uint8{0x2000:0xFF}},
+        {"4E clr", []uint8{0x4E}, Registers{PC:0x1000, A:0x55, CC:N|V|C}, Registers{PC:0x1001, CC:Z}, 2, nil},
+        {"87 sta #", []uint8{0x87, 0x00}, Registers{PC:0x1000, A:0x80, CC:V}, Registers{PC:0x1002, A:0x80, CC:N}, 4, map[uint16]uint8{0x1001:0x80}},
+        {"CF stx #", []uint8{0xCF, 0x00, 0x00}, Registers{PC:0x1000, X:0x1234}, Registers{PC:0x1003, X:0x1234}, 5, map[uint16]uint8{0x1001:0x12, 0x1002:0x34}},
+    }
+    for _, tt := range tests {
+        mmu := &vecmem{bytes:map[uint16]uint8{}, fill:func(uint16) uint8 { return 0 }}
+        for i, b := range tt.code {
+            mmu.bytes[tt.initial.PC + uint16(i)] = b
+        }
+        m := &M6800{Registers:tt.initial, Undocumented:true}
+        cycles, err := run_vector(m, mmu)
+        if err != nil {
+            t.Errorf("%s: %v", tt.name, err)
+            continue
+        }
+        if m.Registers != tt.final {
+            t.Errorf("%s: registers\n     got %s\n    want %s", tt.name, m.Registers.Status(), tt.final.Status())
+        }
+        if cycles != tt.cycles {
+            t.Errorf("%s: %d cycles, want %d", tt.name, cycles, tt.cycles)
+        }
+        for addr, want := range tt.ram {
+            if got := mmu.bytes[addr]; got != want {
+                t.Errorf("%s: $%.4X = 0x%.2X, want 0x%.2X", tt.name, addr, got, want)
+            }
+        }
+    }
+}
+
+// HCF halts until reset, and without the option the opcodes are still illegal
+func TestUndocumentedHCF(t *testing.T) {
+    for _, undocumented := range []bool{true, false} {
+        mmu := &vecmem{bytes:map[uint16]uint8{0x1000:0x9D}, fill:func(uint16) uint8 { return 0 }}
+        m := &M6800{Registers:Registers{PC:0x1000}, Undocumented:undocumented}
+        _, err := m.Step(mmu)
+        switch err.(type) {
+            case ErrHCF:
+                if !undocumented {
+                    t.Errorf("HCF ran without Undocumented set")
+                }
+            case ErrIllegalOpcode:
+                if undocumented {
+                    t.Errorf("HCF is illegal with Undocumented set")
+                }
+            default:
+                t.Fatalf("undocumented:%v, got %v", undocumented, err)
+        }
+        if m.PC != 0x1000 {
+            t.Errorf("PC is $%.4X, want $1000", m.PC)
+        }
+        if _, again := m.Step(mmu); again != err {
+            t.Errorf("second Step returned %v, want %v", again, err)
+        }
+        if _, again := m.Exec(mmu, 100); again != err {
+            t.Errorf("Exec returned %v, want %v", again, err)
+        }
+    }
+}
@@ -0,0 +1,295 @@
+package m6800
+
+import (
+    "encoding/json"
+    "fmt"
+    "sort"
+    "strings"
+)
+
+// Cross-references and the call graph for a traced ROM
+// Every traced instruction that names an address is a reference to it: calls
+// (JSR/BSR), jumps and branches, and reads and writes through Dir, Ext and
+// Idx operands.  Indexed addresses are only known when X was loaded with
+// "ldx #" earlier in the same run of code, which is how the sound ROMs walk
+// their tables, and once X has been stepped in a loop they're given as the
+// table's start plus the offset.  The routines are the vectors, everything
+// called, and the jump table entries, and each one is made of whatever its
+// entry reaches without calling.
+
+type RefKind uint8
+
+const (
+    RefCall RefKind = iota
+    RefJump
+    RefBranch
+    RefRead
+    RefWrite
+    RefPointer   // a jump table or vector entry
+)
+
+var ref_kinds = [...]string{"call", "jump", "branch", "read", "write", "pointer"}
+
+func (k RefKind) String() string {
+    return ref_kinds[k]
+}
+
+func (k RefKind) MarshalText() ([]byte, error) {
+    return []byte(k.String()), nil
+}
+
+type Ref struct {
+    From  uint16   `json:"from"`
+    To    uint16   `json:"to"`
+    Kind  RefKind  `json:"kind"`
+}
+
+type Routine struct {
+    Entry  uint16    `json:"entry"`
+    Name   string    `json:"name"`
+    Calls  []uint16  `json:"calls"`  // routines it calls, directly or through a table
+    Jumps  []uint16  `json:"jumps"`  // routines it jumps into without returning
+}
+
+type Xref struct {
+    Refs      []Ref      // in order of To, then From
+    Routines  []Routine  // in order of Entry
+    listing   *Listing
+}
+
+// how each instruction uses the memory it addresses, r, w or rw
+var mem_access = map[string]string{
+    "lda":"r", "ldb":"r", "ldd":"r", "lds":"r", "ldx":"r",
+    "adda":"r", "addb":"r", "adca":"r", "adcb":"r", "addd":"r", "addx":"r", "adcx":"r",
+    "suba":"r", "subb":"r", "sbca":"r", "sbcb":"r", "subd":"r",
+    "anda":"r", "andb":"r", "ora":"r", "orb":"r", "eora":"r", "eorb":"r",
+    "bita":"r", "bitb":"r", "bitx":"r", "cmpa":"r", "cmpb":"r", "cmpx":"r",
+    "tst":"r", "tim":"r",
+    "sta":"w", "stb":"w", "_std":"w", "sts":"w", "stx":"w", "clr":"w",
+    "inc":"rw", "dec":"rw", "neg":"rw", "ngc":"rw", "com":"rw",
+    "asl":"rw", "asr":"rw", "lsr":"rw", "rol":"rw", "ror":"rw",
+    "aim":"rw", "oim":"rw", "eim":"rw",
+}
+
+// what changes X other than ldx, inx and dex
+var x_clobbers = map[string]bool{
+    "tsx":true, "pulx":true, "xgdx":true, "abx":true, "asx1":true, "asx2":true,
+}
+
+// The name used for addr in the reports, its symbol or Lxxxx like Asm
+func (l *Listing) Name(addr uint16) string {
+    if sym, ok := l.cpu.Symbols.Name(addr); ok {
+        return sym
+    }
+    return fmt.Sprintf("L%.4X", addr)
+}
+
+// Cross-reference the traced code
+func (l *Listing) Xref() *Xref {
+    x := &Xref{listing:l}
+    chunks := l.chunks()
+
+    // control flow first, anywhere it lands is a fresh start for X tracking
+    targets := map[uint16]bool{}
+    for _, c := range chunks {
+        if c.kind != byte_opcode || !c.inst.HasTarget {
+            continue
+        }
+        switch {
+            case c.inst.Mnemonic == "jsr" || c.inst.Mnemonic == "bsr":
+                x.Refs = append(x.Refs, Ref{c.addr, c.inst.Target, RefCall})
+                targets[c.inst.Target] = true
+            case c.inst.Mnemonic == "jmp":
+                x.Refs = append(x.Refs, Ref{c.addr, c.inst.Target, RefJump})
+                targets[c.inst.Target] = true
+            case c.inst.Mode == Rel && c.inst.Mnemonic != "brn":
+                x.Refs = append(x.Refs, Ref{c.addr, c.inst.Target, RefBranch})
+                targets[c.inst.Target] = true
+        }
+    }
+    for _, c := range chunks {
+        if c.kind == byte_word {
+            to := uint16(c.bytes[0])<<8 | uint16(c.bytes[1])
+            x.Refs = append(x.Refs, Ref{c.addr, to, RefPointer})
+            targets[to] = true
+        }
+    }
+
+    // then the data accesses, X is followed from an "ldx #" through inx/dex,
+    // and after a loop back it's taken to still be somewhere in the same table
+    var xbase, xval uint16
+    var xknown, xexact bool
+    ender := true
+    for _, c := range chunks {
+        if c.kind != byte_opcode {
+            xknown, ender = false, true
+            continue
+        }
+        if targets[c.addr] {
+            if ender {
+                xknown = false
+            }
+            xexact = false
+        }
+        inst := c.inst
+        addr, ok := inst.Target, inst.HasTarget && inst.Mode != Rel
+        if (inst.Mode == Idx || inst.Mode == Imx) && xknown {
+            offset := uint16(inst.Bytes[len(inst.Bytes)-1])
+            addr, ok = xbase + offset, true
+            if xexact {
+                addr = xval + offset
+            }
+        }
+        if access := mem_access[inst.Mnemonic]; ok && access != "" {
+            if strings.Contains(access, "r") {
+                x.Refs = append(x.Refs, Ref{c.addr, addr, RefRead})
+            }
+            if strings.Contains(access, "w") {
+                x.Refs = append(x.Refs, Ref{c.addr, addr, RefWrite})
+            }
+        }
+        switch {
+            case inst.Mnemonic == "ldx" && inst.Mode == Imw:
+                xbase, xval, xknown, xexact = inst.Operand, inst.Operand, true, true
+            case inst.Mnemonic == "inx":
+                xval += 1
+            case inst.Mnemonic == "dex":
+                xval -= 1
+            case inst.Mnemonic == "ldx", x_clobbers[inst.Mnemonic]:
+                xknown = false
+        }
+        switch inst.Mnemonic {
+            case "jmp", "rts", "rti", "bra", "hcf":
+                ender = true
+            default:
+                ender = false
+        }
+    }
+    sort.SliceStable(x.Refs, func(i, j int) bool {
+        if x.Refs[i].To != x.Refs[j].To {
+            return x.Refs[i].To < x.Refs[j].To
+        }
+        return x.Refs[i].From < x.Refs[j].From
+    })
+    x.routines()
+    return x
+}
+
+// find the routines and walk each one for its calls and jumps out
+func (x *Xref) routines() {
+    l := x.listing
+    entries := map[uint16]bool{}
+    for _, r := range x.Refs {
+        if r.Kind == RefCall || r.Kind == RefPointer && l.IsCode(r.To) {
+            entries[r.To] = true
+        }
+    }
+    var sorted []uint16
+    for entry := range entries {
+        sorted = append(sorted, entry)
+    }
+    sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+    for _, entry := range sorted {
+        routine := Routine{Entry:entry, Name:l.Name(entry)}
+        calls, jumps := map[uint16]bool{}, map[uint16]bool{}
+        seen := map[uint16]bool{}
+        pending := []uint16{entry}
+        for len(pending) > 0 {
+            pc := pending[len(pending)-1]
+            pending = pending[:len(pending)-1]
+            for l.IsCode(pc) && !seen[pc] {
+                seen[pc] = true
+                inst := l.cpu.Decode(pc, l.mmu)
+                next := pc + inst.Len()
+                switch {
+                    case inst.Mnemonic == "jsr" || inst.Mnemonic == "bsr":
+                        if inst.HasTarget {
+                            calls[inst.Target] = true
+                        }
+                    case inst.Mnemonic == "jmp":
+                        if inst.HasTarget && entries[inst.Target] && inst.Target != entry {
+                            jumps[inst.Target] = true
+                        } else if inst.HasTarget {
+                            pending = append(pending, inst.Target)
+                        }
+                        next = pc  // stop
+                    case inst.Mnemonic == "rts" || inst.Mnemonic == "rti" || inst.Mnemonic == "hcf":
+                        next = pc
+                    case inst.Mode == Rel && inst.Mnemonic != "brn":
+                        pending = append(pending, inst.Target)
+                        if inst.Mnemonic == "bra" {
+                            next = pc
+                        }
+                }
+                // through a jump table
+                for _, to := range l.tables[pc] {
+                    if inst.Mnemonic == "jsr" {
+                        calls[to] = true
+                    } else {
+                        jumps[to] = true
+                    }
+                }
+                if next == pc {
+                    break
+                }
+                pc = next
+            }
+        }
+        routine.Calls = sorted_keys(calls)
+        routine.Jumps = sorted_keys(jumps)
+        x.Routines = append(x.Routines, routine)
+    }
+}
+
+func sorted_keys(set map[uint16]bool) []uint16 {
+    keys := []uint16{}
+    for k := range set {
+        keys = append(keys, k)
+    }
+    sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+    return keys
+}
+
+// The listing, one block per referenced address
+//
+//     $F81E  LF81E
+//         pointer  $F81A
+func (x *Xref) Lines() []string {
+    var lines []string
+    for i, r := range x.Refs {
+        if i == 0 || x.Refs[i-1].To != r.To {
+            lines = append(lines, fmt.Sprintf("$%.4X  %s", r.To, x.listing.Name(r.To)))
+        }
+        lines = append(lines, fmt.Sprintf("    %-8s $%.4X", r.Kind, r.From))
+    }
+    return lines
+}
+
+// The call graph in Graphviz DOT, solid edges for calls, dashed for jumps
+func (x *Xref) DOT() string {
+    var b strings.Builder
+    b.WriteString("digraph calls {\n")
+    b.WriteString("    node [shape=box, fontname=\"monospace\"];\n")
+    for _, r := range x.Routines {
+        fmt.Fprintf(&b, "    \"%.4X\" [label=\"%s\\n$%.4X\"];\n", r.Entry, r.Name, r.Entry)
+    }
+    for _, r := range x.Routines {
+        for _, to := range r.Calls {
+            fmt.Fprintf(&b, "    \"%.4X\" -> \"%.4X\";\n", r.Entry, to)
+        }
+        for _, to := range r.Jumps {
+            fmt.Fprintf(&b, "    \"%.4X\" -> \"%.4X\" [style=dashed];\n", r.Entry, to)
+        }
+    }
+    b.WriteString("}\n")
+    return b.String()
+}
+
+// The references and the call graph as JSON
+func (x *Xref) JSON() ([]byte, error) {
+    return json.MarshalIndent(struct {
+        Routines  []Routine  `json:"routines"`
+        Refs      []Ref      `json:"refs"`
+    }{x.Routines, x.Refs}, "", "  ")
+}
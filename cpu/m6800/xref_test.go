@@ -0,0 +1,83 @@
+package m6800
+
+import (
+    "encoding/json"
+    "strings"
+    "testing"
+
+    "github.com/bartgrantham/fpemu/mem/d8224"
+    "github.com/bartgrantham/fpemu/pia/m6821"
+)
+
+func TestXref(t *testing.T) {
+    rom := make([]uint8, 0x800)
+    copy(rom, dispatcher)
+    rom[0x7F8], rom[0x7F9] = 0xF8, 0x0C  // IRQ
+    rom[0x7FE], rom[0x7FF] = 0xF8, 0x00  // RESET
+    pia := &m6821.M6821{}
+    mmu := d8224.NewD8224Mem(pia)
+    if err := mmu.Mount(0xF800, rom, false); err != nil {
+        t.Fatal(err)
+    }
+    m := NewM6800(mmu, pia)
+    x := m.DisasmTrace(mmu).Xref()
+
+    has := func(want Ref) bool {
+        for _, r := range x.Refs {
+            if r == want {
+                return true
+            }
+        }
+        return false
+    }
+    for _, want := range []Ref{
+        {0xFFF8, 0xF80C, RefPointer},
+        {0xFFFE, 0xF800, RefPointer},
+        {0xF81A, 0xF81E, RefPointer},
+        {0xF81C, 0xF820, RefPointer},
+        {0xF805, 0xF804, RefBranch},
+        {0xF812, 0xF80F, RefBranch},
+        {0xF814, 0xF81A, RefRead},  // ldx 0,x after the inx loop, somewhere in the table
+    } {
+        if !has(want) {
+            t.Errorf("missing %s from $%.4X to $%.4X", want.Kind, want.From, want.To)
+        }
+    }
+    for i := 1; i < len(x.Refs); i++ {
+        a, b := x.Refs[i-1], x.Refs[i]
+        if a.To > b.To || a.To == b.To && a.From > b.From {
+            t.Errorf("refs out of order at %d", i)
+        }
+    }
+
+    var irq *Routine
+    for i := range x.Routines {
+        if x.Routines[i].Entry == 0xF80C {
+            irq = &x.Routines[i]
+        }
+    }
+    if irq == nil {
+        t.Fatal("no routine at $F80C")
+    }
+    if len(irq.Calls) != 2 || irq.Calls[0] != 0xF81E || irq.Calls[1] != 0xF820 {
+        t.Errorf("$F80C calls %v, want [F81E F820] through the table", irq.Calls)
+    }
+
+    if dot := x.DOT(); !strings.Contains(dot, `"F80C" -> "F81E";`) {
+        t.Errorf("DOT is missing the call edge:\n%s", dot)
+    }
+    out, err := x.JSON()
+    if err != nil {
+        t.Fatal(err)
+    }
+    var decoded struct {
+        Routines  []Routine
+        Refs      []struct{ From, To uint16; Kind string }
+    }
+    if err := json.Unmarshal(out, &decoded); err != nil {
+        t.Fatal(err)
+    }
+    if len(decoded.Refs) != len(x.Refs) || decoded.Refs[0].Kind != x.Refs[0].Kind.String() {
+        t.Errorf("JSON refs don't match: %s", out)
+    }
+}
@@ -2,17 +2,17 @@ package main
 
 import (
     "fmt"
-    "io/ioutil"
     "os"
-    "sort"
-    "strconv"
     "strings"
     "time"
 
+    "github.com/bartgrantham/fpemu/board"
+    "github.com/bartgrantham/fpemu/cpu"
     "github.com/bartgrantham/fpemu/cpu/m6800"
     "github.com/bartgrantham/fpemu/mem"
     "github.com/bartgrantham/fpemu/mem/d8224"
     "github.com/bartgrantham/fpemu/misc/hc55516"
+    "github.com/bartgrantham/fpemu/misc/latch"
     "github.com/bartgrantham/fpemu/pia/m6821"
     "github.com/bartgrantham/fpemu/ui"
     "github.com/gdamore/tcell"
@@ -28,12 +28,11 @@ Notes:
     * flags incorrectly set
     * cut and paste bugs
     * outright logic bugs
-    * the C flag in add() still seems weird
-    * the H flag in add() still seems weird
     * pia state machine
     * other hardware features unaccounted for
     * hc55516.CVSD bugs (its very simple, but maybe strange hardware abuse?)
     * double-checked: opcode timing (2021-03-06), flags (2021-03-08)
+    * add()/sub()/NEG/shifts/DAA flags are fuzzed against a reference model, see cpu/m6800/fuzz_test.go
 * documentation
     * http://www.8bit-era.cz/6800.html
     * https://github.com/mamedev/mame/blob/master/src/mame/drivers/williams.cpp#L1899
@@ -57,12 +56,7 @@ Notes:
     * Splat         : 0D, 12, 13/14, 16 (lots of little melodies in 00-07)
     * Thunderball   : 01, 16 (waves+birds!), (has a lot of synthy "breakdown" sounds)
 * Crashes:
-    * Colony7         : crashes immediately on reading $8401
-    * Inferno         : crashes immediately on write to $2001
-    * Lotto Fun       : almost nothing works, most stuff crashes on reading from $BF5F
-    * Mystic Marathon : crashes immediately on write to $2001
     * Playball        : needs RTI implemented
-    * Turkey Shoot    : crashes immediately on write to $2001
 * Sounds wrong, or no sound
     * Blaster      : 18?, 26, 3F?
     * Blackout     : 08?
@@ -89,60 +83,47 @@ TODO:
 
 */
 
-var presets map[string]string = map[string]string{
-    "blaster"   : "F000=roms/blaster/blaster.18",
-    "blackout"  : "B000=roms/blackout/V_IC7.532 C000=roms/blackout/V_IC5.532 D000=roms/blackout/V_IC6.532 F800=roms/blackout/SOUND2.716",
-    "bubbles"   : "F000=roms/bubbles/bubbles.snd RAM=EFFD,DFFD",
-    "colony7"   : "F800=roms/colony7/cs11.bin",
-    "defender"  : "F800=roms/defender/defend.snd RAM=EFFD",
-    "firepower" : "B000=roms/firepower/V_IC7.532 C000=roms/firepower/V_IC5.532 D000=roms/firepower/V_IC6.532 F800=roms/firepower/SOUND3.716",
-    "gorgar"    : "B000=roms/gorgar/v_ic7.532 C000=roms/gorgar/v_ic5.532 D000=roms/gorgar/v_ic6.532 F800=roms/gorgar/sound2.716",
-    "inferno"   : "E000=roms/inferno/ic8.inf",
-    "joust"     : "F000=roms/joust/joust.snd",
-    "junglelord" : "B000=roms/junglelord/speech7.532 C000=roms/junglelord/speech5.532 D000=roms/junglelord/speech6.532 F800=roms/junglelord/sound3.716",
-    "lasercue"  : "F800=roms/lasercue/sound12.716",
-    "lottofun"  : "F000=roms/lottofun/vl2532.snd",
-    "mayday"    : "F800=roms/mayday/ic28-8.bin RAM=EFFD",
-    "mysticmarathon" : "E000=roms/mysticm/mm01_1.a08",
-    "pharaoh"   : "B000=roms/pharaoh/speech7.532 C000=roms/pharaoh/speech5.532 D000=roms/pharaoh/speech6.532 E000=roms/pharaoh/speech4.532 F800=roms/pharaoh/sound12.716",
-    "playball"  : "B000=roms/playball/speech.ic4 C000=roms/playball/speech.ic5 D000=roms/playball/speech.ic6 E000=roms/playball/speech.ic7 F000=roms/playball/playball.snd",
-    "robotron2084" : "F000=roms/robotron2084/robotron.snd",
-    "sinistar"  : "B000=roms/sinistar/speech.ic7 C000=roms/sinistar/speech.ic5 D000=roms/sinistar/speech.ic6 E000=roms/sinistar/speech.ic4 F000=roms/sinistar/sinistar.snd",
-    "splat"     : "F000=roms/splat/splat.snd",
-    "stargate"  : "F800=roms/stargate/sg.snd",
-    "starlight" : "F800=roms/starlight/sound3.716 RAM=DFFD",
-    "thunderball" : "B000=roms/thunderball/speech7.532 C000=roms/thunderball/speech5.532 D000=roms/thunderball/speech6.532 E000=roms/thunderball/speech4.532 F000=roms/thunderball/sound12.532",
-    "timefantasy" : "F800=roms/timefantasy/sound3.716 RAM=DFFD",
-    "turkeyshoot" : "E000=roms/tshoot/rom1.cpu",
-}
-
 func main() {
     var mountspecs []string
-    var preset string
-    var disasm bool
+    var preset, boardfile string
+    var disasm, xref, debug, undocumented bool
+    var symfile string
+    format := "list"
 
-    for i, arg := range os.Args {
-        if i == 0 {
-            continue
-        }
+    for i := 1; i < len(os.Args); i++ {
+        arg := os.Args[i]
         switch {
             case arg == "--disasm":
                 disasm = true
+            case arg == "--xref":
+                xref = true
+            case arg == "--debug":
+                debug = true
+            case arg == "--undocumented":
+                undocumented = true
+            case strings.HasPrefix(arg, "--format="):
+                format = strings.TrimPrefix(arg, "--format=")
+                if format != "list" && format != "asm" && format != "dot" && format != "json" {
+                    fmt.Println("Unknown format:", format, "(list, asm, dot or json)")
+                    os.Exit(-1)
+                }
+            case strings.HasPrefix(arg, "--symbols="):
+                symfile = strings.TrimPrefix(arg, "--symbols=")
+            case strings.HasPrefix(arg, "--board="):
+                boardfile = strings.TrimPrefix(arg, "--board=")
+            case arg == "--board" && i+1 < len(os.Args):
+                i += 1
+                boardfile = os.Args[i]
             case strings.IndexByte(arg, '=') > -1:
                 mountspecs = append(mountspecs, arg)
             default:
-                if tmp, ok := presets[arg]; ok {
-                    preset = tmp
+                if _, ok := board.Builtin(arg); ok {
+                    preset = arg
                 } else {
-                    fmt.Println("Unknown preset:", os.Args[1])
+                    fmt.Println("Unknown preset:", arg)
                     fmt.Println("Available presets:")
-                    var names []string
-                    for k, _ := range presets {
-                        names = append(names, k)
-                    }
-                    sort.Strings(names)
                     out := ""
-                    for _, name := range names {
+                    for _, name := range board.Names() {
                         if out == "" {
                             out += "    " + name
                         } else {
@@ -158,12 +139,9 @@ func main() {
                 }
         }
     }
-    if preset != "" {
-        mountspecs = strings.Fields(preset)
-    }
 
-    // no preset, no mountspecs: try to find a "sound.rom", case-insensitive, in cwd
-    if len(mountspecs) == 0 {
+    // no board, no preset, no mountspecs: try to find a "sound.rom", case-insensitive, in cwd
+    if boardfile == "" && preset == "" && len(mountspecs) == 0 {
         path, err := os.Getwd()
         if err != nil {
             fmt.Println(err)
@@ -183,19 +161,21 @@ func main() {
         for _, file := range files {
             if strings.ToLower(file.Name()) == "sound.rom" {
                 mountspecs = append(mountspecs, "f000=" + file.Name())
-                fmt.Println("found", file.Name())
+                fmt.Fprintln(os.Stderr, "found", file.Name())
                 break
             }
         }
     }
 
-    if len(mountspecs) == 0 {
-        fmt.Println("Usage: fpemu addr=roms/foo addr=roms/bar ...")
-        fmt.Println("   or: fpemu <romset>")
-        fmt.Println("   or: fpemu   # must have \"sound.rom\" in the current directory\n")
+    if boardfile == "" && preset == "" && len(mountspecs) == 0 {
+        fmt.Println("Usage: fpemu addr=roms/foo addr=roms/bar ... [RAM=addr,addr-addr] [CPU=m6802|m6803|hd6301|nsc8105] [CLOCK=hz/divider]")
+        fmt.Println("   or: fpemu [--debug] [--undocumented] [--disasm [--format=list|asm]] [--xref [--format=list|dot|json]] [--symbols=file] <romset>")
+        fmt.Println("   or: fpemu [options] --board=file.json")
+        fmt.Println("   or: fpemu   # must have \"sound.rom\" in the current directory")
+        fmt.Println()
         carriage := 0
         fmt.Printf("romsets: ")
-        for name, _ := range presets {
+        for _, name := range board.Names() {
             if carriage + len(name) > 70 {
                 fmt.Printf("\n         ")
                 carriage = 0
@@ -203,95 +183,173 @@ func main() {
             fmt.Printf(" %s", name)
             carriage += len(name)
         }
-        fmt.Println("\n")
+        fmt.Print("\n\n")
+        os.Exit(-1)
+    }
+
+    var brd *board.Board
+    var err error
+    switch {
+        case boardfile != "":
+            brd, err = board.Load(boardfile)
+        case preset != "":
+            brd, _ = board.Builtin(preset)
+        default:
+            brd, err = board.FromSpecs("command line", mountspecs)
+    }
+    if err != nil {
+        fmt.Println("Invalid board:", err)
         os.Exit(-1)
     }
 
     // Init emulation
     ctrl := make(chan uint8, 10)
-    cvsd := hc55516.CVSD{}
-    pia := &m6821.M6821{CVSD:cvsd}
-    mmu := d8224.NewD8224Mem(pia)
-    for _, arg := range mountspecs {
-        parts := strings.Split(arg, "=")
-        if len(parts) < 2 {
-            fmt.Println("Invalid argument", arg)
-            os.Exit(-1)
-        }
-        if parts[0] == "RAM" {
-            var start, end int64
-            var err error
-            addrs := strings.Split(parts[1], ",")
-            for _, addr := range addrs {
-                startend := strings.Split(addr, "-")
-                if start, err = strconv.ParseInt(startend[0], 16, 32); err != nil {
-                    fmt.Println("Invalid address", startend[0], `"`, err, `"`)
-                    os.Exit(-1)
-                }
-                if len(startend) > 1 {
-                    if end, err = strconv.ParseInt(startend[1], 16, 32); err != nil {
-                        fmt.Println("Invalid address", startend[1], `"`, err, `"`)
-                        os.Exit(-1)
-                    }
+    mmu := d8224.NewD8224Mem(nil)
+    // both were checked when the board was read
+    variant, _ := brd.Variant()
+    clock, _ := brd.CPUClock()
+    // the first PIA is the sound PIA, the others only get their IRQs wired up
+    var pia *m6821.M6821
+    var others []*m6821.M6821
+    for _, dev := range brd.DeviceList() {
+        var d mem.Device
+        switch dev.Type {
+            case "m6821":
+                p := &m6821.M6821{CVSD:hc55516.CVSD{}}
+                if pia == nil {
+                    pia = p
                 } else {
-                    end = start + 1
+                    others = append(others, p)
                 }
-                if (start < 128) || (end >= 1<<16) || (start > end) {
-                    fmt.Println("Invalid addresses:", start, end)
-                        os.Exit(-1)
-                }
-                ram := make([]uint8, end-start)
-                fmt.Printf("mounting %d bytes of RAM at $%.4X\n", len(ram), start)
-                if err := mmu.Mount(uint16(start), ram, true); err != nil {
-                    fmt.Println("Can't mount:", err)
-                    os.Exit(-1)
-                }
-            }
-            continue
+                d = p
+            case "latch":
+                d = latch.NewLatch(dev.Region().Size)
         }
-
-        tmp, err := strconv.ParseInt(parts[0], 16, 32)
-        if err != nil || tmp >= 1<<16 {
-            fmt.Println("Invalid address", arg, `"`, err, `"`)
+        fmt.Fprintf(os.Stderr, "attaching %s at %s\n", dev.Type, dev.Region())
+        if err := mmu.Attach(dev.Region(), d); err != nil {
+            fmt.Println("Can't attach:", err)
             os.Exit(-1)
         }
-        addr := uint16(tmp)
-        fh, err := os.Open(parts[1])
+    }
+    for _, rom := range brd.ROM {
+        data, err := brd.Read(rom)
         if err != nil {
-            fmt.Println("Can't open file", parts[1], ":", err)
+            fmt.Println("Can't load ROM:", err)
             os.Exit(-1)
         }
-        data, err := ioutil.ReadAll(fh)
-        if err != nil {
-            fmt.Println("Can't read file", parts[1], ":", err)
+        region := rom.Region(len(data))
+        fmt.Fprintf(os.Stderr, "mounting %s (%d bytes) at %s\n", brd.Path(rom), len(data), region)
+        if err := mmu.MountRegion(region, data, false); err != nil {
+            fmt.Println("Can't mount:", err)
             os.Exit(-1)
         }
-
-        fmt.Printf("mounting %s (%d bytes) at $%.4X\n", parts[1], len(data), addr)
-        if err := mmu.Mount(addr, data, false); err != nil {
+    }
+    for _, ram := range brd.RAM {
+        data := ram.Bytes()
+        fmt.Fprintf(os.Stderr, "mounting %d bytes of RAM at %s\n", len(data), ram.Region())
+        if err := mmu.MountRegion(ram.Region(), data, true); err != nil {
             fmt.Println("Can't mount:", err)
             os.Exit(-1)
         }
     }
+    port, invert := brd.CommandPort()
 
     M6800 := m6800.NewM6800(mmu, pia)
+    for _, p := range others {
+        p := p
+        M6800.IRQLines = append(M6800.IRQLines, func() bool { return p.IRQ(0) || p.IRQ(1) })
+    }
+    M6800.Variant = variant
+    M6800.Clock = clock
+    M6800.Debug = debug  // single-steps and keeps history for the fault report
+    M6800.Undocumented = undocumented  // NMOS behavior for the illegal opcodes, 6800 only
+    M6800.Logger = ui.Log
+    // the PIAs are named where the board puts them, PIA, PIA2, ...
+    npia := 0
+    for _, dev := range brd.DeviceList() {
+        if dev.Type != "m6821" {
+            continue
+        }
+        npia += 1
+        prefix := "PIA"
+        if npia > 1 {
+            prefix = fmt.Sprintf("PIA%d", npia)
+        }
+        M6800.Symbols.AddPIA(prefix, dev.Region().Base)
+    }
+    if symfile != "" {
+        // on top of the built-in PIA and vector names
+        if err := M6800.Symbols.LoadFile(symfile); err != nil {
+            fmt.Println("Can't load symbols:", err)
+            os.Exit(-1)
+        }
+        fmt.Fprintf(os.Stderr, "loaded %d symbols from %s\n", M6800.Symbols.Len(), symfile)
+    }
+    var proc cpu.CPU16 = M6800
+
+    // Short-circuit for xref, the references and call graph of the traced code
+    if xref {
+        report := M6800.DisasmTrace(mmu).Xref()
+        switch format {
+            case "list":
+                for _, line := range report.Lines() {
+                    fmt.Println(line)
+                }
+            case "dot":
+                fmt.Print(report.DOT())
+            case "json":
+                out, err := report.JSON()
+                if err != nil {
+                    fmt.Println(err)
+                    os.Exit(-1)
+                }
+                fmt.Println(string(out))
+            default:
+                fmt.Println("--xref can't do --format=" + format, "(list, dot or json)")
+                os.Exit(-1)
+        }
+        os.Exit(0)
+    }
 
-    // Short-circuit for disasm
+    // Short-circuit for disasm, only what's reachable from the vectors is code
     if disasm {
-        for addr:=0; addr<(1<<16); {
-            out, adv := M6800.Disasm(uint16(addr), mmu)
-            if adv != 0 {
-                fmt.Println(out)
-                addr += int(adv)
-            } else {
-                addr += 1
+        listing := M6800.DisasmTrace(mmu)
+        if format == "dot" || format == "json" {
+            fmt.Println("--disasm can't do --format=" + format, "(list or asm)")
+            os.Exit(-1)
+        }
+        if format == "list" {
+            for _, line := range listing.Lines() {
+                fmt.Println(line)
             }
+            os.Exit(0)
+        }
+        for _, line := range listing.Asm() {
+            fmt.Println(line)
+        }
+        // the source is only useful if it builds the same ROM
+        if err := listing.Verify(); err != nil {
+            fmt.Fprintln(os.Stderr, "round trip failed:", err)
+            os.Exit(1)
         }
+        fmt.Fprintln(os.Stderr, "round trip ok, reassembles to the mounted ROM")
         os.Exit(0)
     }
 
     // Init Host Audio
-    err := ui.StartAudio(M6800.Callback(mmu, ctrl, pia))
+    // resets are done between buffers so they don't race the CPU
+    resets := make(chan bool, 1)
+    fmt.Fprintf(os.Stderr, "clock %s\n", clock)
+    audio := M6800.Callback(mmu, ctrl, pia, port)
+    err = ui.StartAudio(func(out []float32) {
+        select {
+            case clear := <-resets:
+                mmu.Reset(clear)
+                proc.Reset(mmu)
+            default:
+        }
+        audio(out)
+    })
     if err != nil {
         fmt.Println("Couldn't start audio:", err)
         os.Exit(-1)
@@ -308,7 +366,6 @@ func main() {
         fmt.Println("Error opening screen:", err)
         os.Exit(-1)
     }
-    m6800.Scr = screen
 
     // Run UI
     var last_chr rune
@@ -316,10 +373,10 @@ func main() {
     bank := uint8(0)
     dl := []ui.Draw{func(){
         ramBox(screen, 3, 0, "IRAM", 0x0, mmu)
-        cpuBox(screen, 64, 0, M6800, bank)
+        cpuBox(screen, 64, 0, proc, bank, M6800.Symbols)
         //ui.LogBox(screen, 3, 13, "Log")
         kbBox(screen, 7, 12, bank, last_chr, last_time)
-        quitBox(screen, 27, 23)
+        quitBox(screen, 9, 23)
     }}
     tui := ui.TextUI{
         Screen:screen,
@@ -332,7 +389,10 @@ func main() {
         if r := recover(); r != nil {
         }
         screen.Fini()
-        fmt.Println(M6800.Status())
+        fmt.Println(proc.Status())
+        if proc.Halted() != nil {
+            faultReport(proc, mmu)
+        }
         //ui.DumpLog()
     }()
 
@@ -352,10 +412,20 @@ func main() {
         switch e.Key() {
             case tcell.KeyCtrlC:
                 break evtloop
+            case tcell.KeyCtrlR, tcell.KeyCtrlX:
+                // warm reset keeps RAM, cold reset clears it
+                select {
+                    case resets <- e.Key() == tcell.KeyCtrlX:
+                    default:
+                }
             case tcell.KeyRune:
                 chr := e.Rune()
                 code, ok := chr2code[chr]
                 switch {
+                    case ok && invert:
+                        ctrl <- (bank*32 + code) ^ 0xFF
+                        last_chr = chr
+                        last_time = time.Now()
                     case ok:
                         ctrl <- bank*32 + code
                         last_chr = chr
@@ -418,31 +488,71 @@ func ramBox(s tcell.Screen, x, y int, label string, addr uint16, mem mem.MMU16)
 }
 
 
-func cpuBox(s tcell.Screen, x, y int, cpu *m6800.M6800, bank uint8) {
+func cpuBox(s tcell.Screen, x, y int, proc cpu.CPU16, bank uint8, syms *m6800.Symbols) {
     ui.Box(s, x, y, 20, 11)
     style := tcell.StyleDefault.Foreground(tcell.ColorWhite).Bold(true)
-    ui.DrawString(s, x+2, y, style, " M6802 ")
-    style = tcell.StyleDefault.Foreground(tcell.ColorGray)
+    ui.DrawString(s, x+2, y, style, " "+proc.Name()+" ")
+    label := tcell.StyleDefault.Foreground(tcell.ColorGray)
+    value := tcell.StyleDefault.Foreground(tcell.ColorWhite)
     col := x+2
     row := y+2
-    ui.DrawString(s, col, row, style, "PC:")
-    ui.DrawString(s, col, row+1, style, "SP:")
-    ui.DrawString(s, col, row+2, style, " X:")
-    ui.DrawString(s, col, row+3, style, " A:")
-    ui.DrawString(s, col, row+4, style, " B:")
-    ui.DrawString(s, col, row+6, style, "      --HINZVC")
-    ui.DrawString(s, col, row+7, style, "CC:")
-    style = tcell.StyleDefault.Foreground(tcell.ColorWhite)
-    col = col + 4
-    ui.DrawString(s, col, row, style, fmt.Sprintf("$%.4X", cpu.PC))
-    ui.DrawString(s, col, row+1, style, fmt.Sprintf("$%.4X", cpu.SP))
-    ui.DrawString(s, col, row+2, style, fmt.Sprintf("$%.4X", cpu.X))
-    ui.DrawString(s, col, row+3, style, fmt.Sprintf("0x%.2X", cpu.A))
-    ui.DrawString(s, col, row+4, style, fmt.Sprintf("0x%.2X", cpu.B))
-    ui.DrawString(s, col, row+7, style, fmt.Sprintf("0b%.8b", cpu.CC))
+    for _, reg := range proc.Regs() {
+        val := proc.Reg(reg.Name)
+        name := fmt.Sprintf("%2s:", reg.Name)
+        switch {
+            case reg.Flags != "":
+                row += 1
+                ui.DrawString(s, col, row, label, fmt.Sprintf("%*s", 6+len(reg.Flags), reg.Flags))
+                row += 1
+                ui.DrawString(s, col, row, label, name)
+                ui.DrawString(s, col+4, row, value, fmt.Sprintf("0b%.*b", reg.Bits, val))
+            case reg.Bits > 8:
+                ui.DrawString(s, col, row, label, name)
+                ui.DrawString(s, col+4, row, value, fmt.Sprintf("$%.4X", val))
+                if sym, ok := syms.Name(val); ok && reg.Name == "PC" {
+                    if len(sym) > 7 {
+                        sym = sym[:7]
+                    }
+                    ui.DrawString(s, col+10, row, label, sym)
+                }
+            default:
+                ui.DrawString(s, col, row, label, name)
+                ui.DrawString(s, col+4, row, value, fmt.Sprintf("0x%.2X", val))
+        }
+        row += 1
+    }
 
     bankstr := fmt.Sprintf("BANK : %.2x", bank)
-    ui.DrawString(s, col, row+8, style, bankstr)
+    ui.DrawString(s, col+4, row, value, bankstr)
+    if proc.Halted() != nil {
+        style = tcell.StyleDefault.Foreground(tcell.ColorRed).Bold(true)
+        ui.DrawString(s, x+11, y, style, " HALT ")
+    }
+}
+
+// what the CPU was doing when it halted, printed after the screen is torn down
+func faultReport(proc cpu.CPU16, mmu mem.MMU16) {
+    fmt.Println(proc.Halted())
+    if h, ok := proc.(interface{ History(mem.MMU16) []string }); ok {
+        lines := h.History(mmu)
+        if len(lines) == 0 {
+            fmt.Println("(no instruction history, run with --debug to keep one)")
+        }
+        for _, line := range lines {
+            fmt.Println(line)
+        }
+    }
+    for index:=0; index<0x80; index+=0x20 {
+        out := "    "
+        for offset:=0; offset<0x20; offset++ {
+            val := mmu.Peek8(uint16(index+offset))
+            out += fmt.Sprintf("%.2x ", val)
+            if offset == 0x0f {
+                out += "  "
+            }
+        }
+        fmt.Println(out)
+    }
 }
 
 var bignums [][]string = [][]string{
@@ -557,7 +667,7 @@ func kbBox(s tcell.Screen, x, y int, bank uint8, last_chr rune, last_time time.T
 
 func quitBox(s tcell.Screen, x, y int) {
     style := tcell.StyleDefault.Foreground(tcell.ColorWhite).Bold(true)
-    for i, c := range "---=== CTRL-C to quit ===---" {
+    for i, c := range "---=== CTRL-C to quit, CTRL-R warm reset, CTRL-X cold reset ===---" {
         s.SetContent(x+i, y, c, []rune{}, style)
     }
 }
@@ -0,0 +1,139 @@
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "io/ioutil"
+    "os"
+    "os/exec"
+    "path/filepath"
+    "regexp"
+    "strings"
+    "testing"
+
+    "github.com/bartgrantham/fpemu/cpu/m6800"
+)
+
+// the test binary runs main() when it's started with FPEMU_MAIN set, so the
+// tests can run the emulator as a command and look at what it prints
+func TestMain(m *testing.M) {
+    if os.Getenv("FPEMU_MAIN") != "" {
+        main()
+        os.Exit(0)
+    }
+    os.Exit(m.Run())
+}
+
+// a ROM with a reset routine that calls a subroutine and then loops
+var e2e_rom = []uint8{
+    0x8E, 0x00, 0x7F,        // F800  lds   #$007F
+    0xBD, 0xF8, 0x09,        // F803  jsr   $F809
+    0x7E, 0xF8, 0x03,        // F806  jmp   $F803
+    0x86, 0x04,              // F809  ldaa  #$04
+    0xB7, 0x04, 0x01,        // F80B  staa  $0401
+    0x39,                    // F80E  rts
+}
+
+// e2e_rom in a file, for the tests to mount
+func rom_file(t *testing.T) (rom []uint8, file string) {
+    rom = make([]uint8, 0x800)
+    copy(rom, e2e_rom)
+    rom[0x7FE], rom[0x7FF] = 0xF8, 0x00
+    file = filepath.Join(t.TempDir(), "sound.rom")
+    if err := ioutil.WriteFile(file, rom, 0644); err != nil {
+        t.Fatal(err)
+    }
+    return rom, file
+}
+
+// run the emulator, stdout and stderr are kept apart
+func fpemu(t *testing.T, args ...string) (stdout string) {
+    cmd := exec.Command(os.Args[0], args...)
+    cmd.Env = append(os.Environ(), "FPEMU_MAIN=1")
+    var out, errs bytes.Buffer
+    cmd.Stdout, cmd.Stderr = &out, &errs
+    if err := cmd.Run(); err != nil {
+        t.Fatalf("fpemu %s: %v\n%s", strings.Join(args, " "), err, errs.String())
+    }
+    return out.String()
+}
+
+// stdout is nothing but the source, it reassembles to the ROM
+func TestDisasmAsm(t *testing.T) {
+    rom, file := rom_file(t)
+    out := fpemu(t, "f800=" + file, "--disasm", "--format=asm")
+    image, err := (&m6800.M6800{}).Assemble(out)
+    if err != nil {
+        t.Fatalf("%v\n%s", err, out)
+    }
+    for i, val := range rom {
+        if addr := 0xF800 + uint16(i); image[addr] != val {
+            t.Fatalf("$%.4X assembled to 0x%.2X, ROM has 0x%.2X", addr, image[addr], val)
+        }
+    }
+}
+
+// stdout is the report and nothing else, the JSON decodes
+func TestXrefJSON(t *testing.T) {
+    _, file := rom_file(t)
+    out := fpemu(t, "f800=" + file, "--xref", "--format=json")
+    var report struct {
+        Routines  []m6800.Routine  `json:"routines"`
+        Refs      []struct {
+            From, To  uint16
+            Kind      string
+        }  `json:"refs"`
+    }
+    if err := json.Unmarshal([]byte(out), &report); err != nil {
+        t.Fatalf("%v\n%s", err, out)
+    }
+    calls := false
+    for _, r := range report.Routines {
+        for _, to := range r.Calls {
+            calls = calls || (r.Entry == 0xF800 && to == 0xF809)
+        }
+    }
+    if !calls {
+        t.Errorf("no call from $F800 to $F809 in %v", report.Routines)
+    }
+    if len(report.Refs) == 0 || report.Refs[0].Kind == "" {
+        t.Errorf("refs are %v", report.Refs)
+    }
+}
+
+// the statements DOT() writes
+var dot_line = regexp.MustCompile(`^    ("[0-9A-F]{4}" (\[.*\]|-> "[0-9A-F]{4}"( \[style=dashed\])?)|node \[.*\]);$`)
+
+// stdout is the graph and nothing else, every line is a statement Graphviz
+// takes
+func TestXrefDOT(t *testing.T) {
+    _, file := rom_file(t)
+    out := fpemu(t, "f800=" + file, "--xref", "--format=dot")
+    lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+    if len(lines) < 2 || lines[0] != "digraph calls {" || lines[len(lines)-1] != "}" {
+        t.Fatalf("not a digraph:\n%s", out)
+    }
+    for _, line := range lines[1:len(lines)-1] {
+        if !dot_line.MatchString(line) {
+            t.Errorf("not a DOT statement: %q", line)
+        }
+    }
+    if !strings.Contains(out, `"F800" -> "F809";`) {
+        t.Errorf("no call from $F800 to $F809 in\n%s", out)
+    }
+}
+
+// the PIA is named where the board puts it
+func TestPIASymbols(t *testing.T) {
+    _, file := rom_file(t)
+    brd := filepath.Join(t.TempDir(), "board.json")
+    text := `{"name":"test", "rom":[{"addr":"F800", "file":"` + file + `"}],
+        "devices":[{"type":"m6821", "addr":"2000", "mask":"E003"}]}`
+    if err := ioutil.WriteFile(brd, []byte(text), 0644); err != nil {
+        t.Fatal(err)
+    }
+    out := fpemu(t, "--board=" + brd, "--disasm", "--format=asm")
+    if !strings.Contains(out, "PIA_CRA equ   $2001") || strings.Contains(out, "equ   $0401") {
+        t.Errorf("PIA names aren't at $2000:\n%s", out)
+    }
+}
@@ -3,15 +3,68 @@ package d8224
 import (
     "fmt"
     "log"
+    "strings"
+
+    "github.com/bartgrantham/fpemu/mem"
     "github.com/bartgrantham/fpemu/pia"
 )
 
+// The boards only decode some of the address lines, so a chip answers at
+// every address that matches it on the lines that are decoded.  A Region is
+// one chip's window: addr is in it if addr&Mask lands in the Size bytes from
+// Base&Mask, so a Mask of $FFFF is a full decode and $7FFF mirrors it $8000
+// away.  Base is the copy that isn't a mirror, the one the tools list.
+type Region struct {
+    Base  uint16
+    Size  int
+    Mask  uint16
+}
+
+// fully decoded, no mirrors
+func Span(base uint16, size int) Region {
+    return Region{base, size, 0xFFFF}
+}
+
+// where in the region addr is, -1 if it isn't
+func (r Region) Offset(addr uint16) int {
+    off := int(addr&r.Mask) - int(r.Base&r.Mask)
+    if off < 0 || off >= r.Size {
+        return -1
+    }
+    return off
+}
+
+// every byte from Base on decodes to itself, the mask doesn't fold the region
+func (r Region) whole() bool {
+    for i := 0; i < r.Size; i++ {
+        if r.Offset(r.Base + uint16(i)) != i {
+            return false
+        }
+    }
+    return true
+}
+
+func (r Region) String() string {
+    if r.Mask == 0xFFFF {
+        return fmt.Sprintf("$%.4X-$%.4X", r.Base, int(r.Base) + r.Size - 1)
+    }
+    return fmt.Sprintf("$%.4X-$%.4X mask $%.4X", r.Base, int(r.Base) + r.Size - 1, r.Mask)
+}
+
+// a device and where it answers
+type mapping struct {
+    region  Region
+    dev     mem.Device
+}
+
 type D8224Mem struct {
-    PIA       pia.PIA
     RxM       [1<<16]uint8  // $0000-$FFFF
+    alias     [1<<16]uint16 // the address in RxM each bus address decodes to
+    devices   []mapping
+    device    [1<<16]uint8  // index+1 into devices for each address, 0 for memory
     validr    [1<<16]bool
     validw    [1<<16]bool
-    reads     [1<<16]int
+    reads     [1<<16]int    // by RxM address, a mirror counts where it decodes to
     writes    [1<<16]int
     fastfail  bool
 }
@@ -19,8 +72,15 @@ type D8224Mem struct {
 type reads struct {
 }
 
+// With the sound board PIA at $0400, or with no devices if pia is nil
 func NewD8224Mem(pia pia.PIA) *D8224Mem {
-    d := D8224Mem{PIA:pia}
+    d := D8224Mem{}
+    for i := range d.alias {
+        d.alias[i] = uint16(i)
+    }
+    if pia != nil {
+        d.Attach(Span(0x400, 4), pia)
+    }
     // the 6802 has 128b built-in
     for i:=0; i<128; i++ {
         d.validr[i] = true
@@ -31,102 +91,178 @@ func NewD8224Mem(pia pia.PIA) *D8224Mem {
 }
 
 func (d *D8224Mem) Mount(addr uint16, data []byte, rw bool) error {
-    if int(addr) + len(data) > 1<<16 {
+    return d.MountRegion(Span(addr, len(data)), data, rw)
+}
+
+// Mount data at r.Base, and at every mirror of it r's mask makes
+func (d *D8224Mem) MountRegion(r Region, data []byte, rw bool) error {
+    if len(data) != r.Size || int(r.Base) + r.Size > 1<<16 {
         return fmt.Errorf("invalid mount")
     }
-    if int(addr) < 128 {
+    if int(r.Base) < 128 || !r.whole() {
         return fmt.Errorf("invalid mount")
     }
+    // the mirrors can't land on anything already there
+    for addr := 0; addr < 1<<16; addr++ {
+        if r.Offset(uint16(addr)) < 0 {
+            continue
+        }
+        if d.validr[addr] || d.alias[addr] != uint16(addr) || d.device[addr] != 0 {
+            return fmt.Errorf("%s overlaps $%.4X", r, addr)
+        }
+    }
+    for addr := 0; addr < 1<<16; addr++ {
+        if off := r.Offset(uint16(addr)); off > -1 {
+            d.alias[addr] = r.Base + uint16(off)
+        }
+    }
     for i, b := range data {
-        d.RxM[int(addr) + i] = b
-        d.validr[int(addr) + i] = true
+        d.RxM[int(r.Base) + i] = b
+        d.validr[int(r.Base) + i] = true
         if rw {
-            d.validw[int(addr) + i] = true
+            d.validw[int(r.Base) + i] = true
+        }
+    }
+    return nil
+}
+
+// Map a device into r, it's given the offset into r on each access.  Like
+// mounting it can't land on anything already there.
+func (d *D8224Mem) Attach(r Region, dev mem.Device) error {
+    if r.Size < 1 || int(r.Base) + r.Size > 1<<16 || int(r.Base) < 128 || !r.whole() {
+        return fmt.Errorf("invalid device mapping %s", r)
+    }
+    if len(d.devices) == 255 {
+        return fmt.Errorf("too many devices")
+    }
+    for addr := 0; addr < 1<<16; addr++ {
+        if r.Offset(uint16(addr)) > -1 && (d.validr[addr] || d.alias[addr] != uint16(addr) || d.device[addr] != 0) {
+            return fmt.Errorf("device at %s overlaps $%.4X", r, addr)
+        }
+    }
+    d.devices = append(d.devices, mapping{r, dev})
+    for addr := 0; addr < 1<<16; addr++ {
+        if r.Offset(uint16(addr)) > -1 {
+            d.device[addr] = uint8(len(d.devices))
         }
     }
     return nil
 }
 
+// the device at addr and the offset into it, nil if it's memory
+func (d *D8224Mem) decode(addr uint16) (mem.Device, uint16) {
+    i := d.device[addr]
+    if i == 0 {
+        return nil, 0
+    }
+    m := &d.devices[i-1]
+    return m.dev, uint16(m.region.Offset(addr))
+}
+
+// The address a mirror decodes to, ok is false if addr isn't a mirror
+func (d *D8224Mem) Mirror(addr uint16) (uint16, bool) {
+    return d.alias[addr], d.alias[addr] != addr
+}
+
+// Reset the devices on the bus, and zero the RAM if clear is set
+// ROM contents and the heat counters are untouched
+func (d *D8224Mem) Reset(clear bool) {
+    for _, m := range d.devices {
+        m.dev.Reset()
+    }
+    if !clear {
+        return
+    }
+    for i := range d.RxM {
+        if d.validw[i] {
+            d.RxM[i] = 0
+        }
+    }
+}
+
+// pass the access time on to the devices
+func (d *D8224Mem) SetCycle(cycle uint64) {
+    for _, m := range d.devices {
+        m.dev.Tick(cycle)
+    }
+}
+
 // temporary
 func (d *D8224Mem) String() string {
-    return d.PIA.String()
+    var out []string
+    for _, m := range d.devices {
+        if s, ok := m.dev.(fmt.Stringer); ok {
+            out = append(out, s.String())
+        }
+    }
+    return strings.Join(out, " | ")
 }
 
 func (d *D8224Mem) Valid(addr uint16) (bool, bool) {
-    return d.validr[int(addr)], d.validw[int(addr)]
+    a := d.alias[addr]
+    return d.validr[a], d.validw[a]
 }
 
 func (d *D8224Mem) Peek8(addr uint16) uint8 {
     val := uint8(0)
-    switch {
-        case addr >= 0x400 && addr <= 0x403:
-            val = d.PIA.R8(addr-0x400)
-        case d.validr[addr]:
-            val = d.RxM[addr]
+    a := d.alias[addr]
+    switch dev, off := d.decode(addr); {
+        case dev != nil:
+            val = dev.Peek8(off)
+        case d.validr[a]:
+            val = d.RxM[a]
         default:
-            err := fmt.Sprintf("Peek8 invalid address: $%.4X", addr)
-            if d.fastfail {  panic(err)  } else {  log.Println(err)  }
+            err := mem.AccessError{Addr:addr}
+            if d.fastfail {  panic(err)  } else {  log.Println("Peek8", err)  }
     }
     return val
 }
 
 func (d *D8224Mem) R8(addr uint16) uint8 {
-    d.reads[addr] += 1
+    a := d.alias[addr]
+    d.reads[a] += 1
     val := uint8(0)
-    switch {
-        case addr >= 0x400 && addr <= 0x403:
-            val = d.PIA.R8(addr-0x400)
-        case d.validr[addr]:
-            val = d.RxM[addr]
+    switch dev, off := d.decode(addr); {
+        case dev != nil:
+            val = dev.R8(off)
+        case d.validr[a]:
+            val = d.RxM[a]
 //        case addr == uint16(0xeffd) || addr == uint16(0xdffd):
             // This address is sometimes probed to see if speech roms are installed
             //log.Printf("R16 invalid address: $%.4X", addr)
         default:
-            err := fmt.Sprintf("R8 invalid address: $%.4X", addr)
-            if d.fastfail {  panic(err)  } else {  log.Println(err)  }
+            err := mem.AccessError{Addr:addr}
+            if d.fastfail {  panic(err)  } else {  log.Println("R8", err)  }
     }
     return val
 }
 
 func (d *D8224Mem) W8(addr uint16, val uint8) {
-    d.writes[addr] += 1
-    switch {
-        case addr >= 0x400 && addr <= 0x403:
-            d.PIA.W8(addr-0x400, val)
-        case d.validw[addr]:
-            d.RxM[addr] = val
+    a := d.alias[addr]
+    d.writes[a] += 1
+    switch dev, off := d.decode(addr); {
+        case dev != nil:
+            dev.W8(off, val)
+        case d.validw[a]:
+            d.RxM[a] = val
         default:
-            err := fmt.Sprintf("W8 invalid address (val): $%.4X (%.2X)", addr, val)
-            if d.fastfail {  panic(err)  } else {  log.Println(err)  }
+            err := mem.AccessError{Addr:addr, Write:true}
+            if d.fastfail {  panic(err)  } else {  log.Printf("W8 %s (%.2X)", err, val)  }
     }
     return
 }
 
+// big endian, high byte first, two byte accesses like the CPU makes them, so
+// devices and mirrors see the same thing and $FFFF wraps to $0000
 func (d *D8224Mem) R16(addr uint16) uint16 {
-    var high, low uint8
-    d.reads[addr] += 1
-    d.reads[addr+1] += 1
-    if d.validr[addr] && d.validr[addr+1] {
-        high = d.RxM[addr]
-        low  = d.RxM[addr+1]
-    } else {
-        err := fmt.Sprintf("R16 invalid address: $%.4X", addr)
-        if d.fastfail {  panic(err)  } else {  log.Println(err)  }
-    }
+    high := d.R8(addr)
+    low := d.R8(addr+1)
     return (uint16(high)<<8) + uint16(low)
 }
 
 func (d *D8224Mem) W16(addr uint16, val uint16) {
-    d.writes[addr] += 1
-    d.writes[addr+1] += 1
-    if d.validw[addr] && d.validw[addr+1] {
-        d.RxM[addr] = uint8(val>>8)
-        d.RxM[addr+1] = uint8(val)
-    } else {
-        err := fmt.Sprintf("W16 invalid address: $%.4X", addr)
-        if d.fastfail {  panic(err)  } else {  log.Println(err)  }
-    }
-    return
+    d.W8(addr, uint8(val>>8))
+    d.W8(addr+1, uint8(val))
 }
 
 func (d *D8224Mem) Heat(start, end uint16) ([]uint8, []int, []int) {
@@ -0,0 +1,167 @@
+package d8224
+
+import (
+    "testing"
+
+    "github.com/bartgrantham/fpemu/misc/latch"
+    "github.com/bartgrantham/fpemu/pia/m6821"
+)
+
+func TestRegion(t *testing.T) {
+    r := Region{0x0400, 4, 0x7FFF}
+    for _, tc := range []struct{ addr uint16; off int }{
+        {0x0400, 0}, {0x0403, 3}, {0x8401, 1}, {0x8403, 3},
+        {0x0404, -1}, {0x03FF, -1}, {0x4400, -1}, {0xC400, -1},
+    } {
+        if off := r.Offset(tc.addr); off != tc.off {
+            t.Errorf("$%.4X is at %d, want %d", tc.addr, off, tc.off)
+        }
+    }
+    // listed at the top mirror
+    r = Region{0xF800, 0x800, 0xBFFF}
+    if r.Offset(0xB801) != 1 || r.Offset(0xF801) != 1 || r.Offset(0xD801) != -1 {
+        t.Errorf("$F800 mask $BFFF doesn't decode $B801/$F801")
+    }
+    if s := Span(0xF800, 0x800).String(); s != "$F800-$FFFF" {
+        t.Errorf("got %q", s)
+    }
+}
+
+func TestMirrors(t *testing.T) {
+    pia := &m6821.M6821{}
+    d := NewD8224Mem(nil)
+    if err := d.Attach(Region{0x0400, 4, 0x7FFF}, pia); err != nil {
+        t.Fatal(err)
+    }
+    // 2K of ROM decoded on A0-A10 and A15, at $F800 and $B800
+    rom := make([]uint8, 0x800)
+    rom[0x123] = 0xA5
+    if err := d.MountRegion(Region{0xB800, 0x800, 0xBFFF}, rom, false); err != nil {
+        t.Fatal(err)
+    }
+    if v := d.R8(0xB923); v != 0xA5 {
+        t.Errorf("$B923 is 0x%.2X", v)
+    }
+    if v := d.R8(0xF923); v != 0xA5 {
+        t.Errorf("mirror $F923 is 0x%.2X", v)
+    }
+    if a, ok := d.Mirror(0xF923); !ok || a != 0xB923 {
+        t.Errorf("$F923 mirrors $%.4X %v", a, ok)
+    }
+    if _, ok := d.Mirror(0xB923); ok {
+        t.Error("$B923 isn't a mirror")
+    }
+    if r, w := d.Valid(0xF923); !r || w {
+        t.Errorf("$F923 valid %v %v", r, w)
+    }
+    if _, reads, _ := d.Heat(0xB923, 0xB924); reads[0] != 1 {
+        t.Errorf("$B923 has %d reads, the mirror should count there", reads[0])
+    }
+
+    // the PIA's mirror at $8400 is the same PIA
+    d.W8(0x8401, 0x04)
+    if pia.CRA != 0x04 || d.R8(0x0401) != 0x04 {
+        t.Errorf("CRA is 0x%.2X after writing the mirror", pia.CRA)
+    }
+
+    for _, tc := range []struct{ r Region; size int }{
+        {Region{0x3800, 0x800, 0x3FFF}, 0x800},  // mirrors over the ROM
+        {Region{0x0300, 0x200, 0xFFFF}, 0x200},  // over the PIA
+        {Region{0x8400, 4, 0xFFFF}, 4},           // over the PIA's mirror
+        {Region{0x9000, 0x200, 0xFEFF}, 0x200},  // folds onto itself
+        {Region{0x9000, 0x100, 0xFFFF}, 0x10},   // wrong size
+    } {
+        if err := d.MountRegion(tc.r, make([]uint8, tc.size), true); err == nil {
+            t.Errorf("%s should fail", tc.r)
+        }
+    }
+    if err := d.Attach(Region{0xF800, 4, 0xFFFF}, &m6821.M6821{}); err == nil {
+        t.Error("PIA over the ROM mirror should fail")
+    }
+    if err := d.Attach(Region{0x0402, 4, 0xFFFF}, &m6821.M6821{}); err == nil {
+        t.Error("PIA over the PIA should fail")
+    }
+}
+
+func TestDevices(t *testing.T) {
+    pia := &m6821.M6821{}
+    d := NewD8224Mem(pia)
+    // a latch on A0-A1 in $2000-$3FFF, the way a second generation board
+    // decodes its PIA
+    l := latch.NewLatch(4)
+    if err := d.Attach(Region{0x2000, 4, 0xE003}, l); err != nil {
+        t.Fatal(err)
+    }
+    d.W8(0x2001, 0x12)
+    d.W8(0x3FFE, 0x34)
+    if l.Regs[1] != 0x12 || l.Regs[2] != 0x34 {
+        t.Errorf("latch is % X", l.Regs)
+    }
+    if v := d.R8(0x2005); v != 0x12 {
+        t.Errorf("$2005 is 0x%.2X", v)
+    }
+
+    // Peek8 leaves the PIA's interrupt flags alone, R8 clears them
+    d.W8(0x0401, 0x04)  // CRA: ORA, not DDRA
+    pia.Write(0, 0x55)
+    pia.CRA |= m6821.IRQx1
+    if v := d.Peek8(0x0400); v != 0x55 || !pia.IRQA || pia.CRA&m6821.IRQx1 == 0 {
+        t.Errorf("Peek8 got 0x%.2X, IRQA %v CRA 0x%.2X", v, pia.IRQA, pia.CRA)
+    }
+    if v := d.R8(0x0400); v != 0x55 || pia.IRQA {
+        t.Errorf("R8 got 0x%.2X, IRQA %v", v, pia.IRQA)
+    }
+
+    d.Reset(false)
+    if pia.CRA != 0 || l.Regs[1] != 0 {
+        t.Errorf("reset left CRA 0x%.2X, latch % X", pia.CRA, l.Regs)
+    }
+}
+
+func TestR16(t *testing.T) {
+    pia := &m6821.M6821{}
+    d := NewD8224Mem(pia)
+    ram := make([]uint8, 0x100)
+    if err := d.Mount(0x0300, ram, true); err != nil {
+        t.Fatal(err)
+    }
+    rom := make([]uint8, 0x800)
+    rom[0x7FF] = 0x12
+    if err := d.Mount(0xF800, rom, false); err != nil {
+        t.Fatal(err)
+    }
+
+    // $FFFF wraps to internal RAM at $0000
+    d.W8(0x0000, 0x34)
+    if v := d.R16(0xFFFF); v != 0x1234 {
+        t.Errorf("R16($FFFF) is $%.4X", v)
+    }
+
+    // a word across the end of RAM and the PIA goes to the PIA's register
+    d.W8(0x0401, 0x00)  // CRA: DDRA
+    d.W16(0x03FF, 0xABCD)
+    if v := d.Peek8(0x03FF); v != 0xAB || pia.DDRA != 0xCD {
+        t.Errorf("RAM $03FF is 0x%.2X, DDRA 0x%.2X", v, pia.DDRA)
+    }
+    if v := d.R16(0x03FF); v != 0xABCD {
+        t.Errorf("R16($03FF) is $%.4X", v)
+    }
+    // reading ORA through R16 clears the PIA's interrupt, like LDX would
+    d.W16(0x0400, 0x0004)  // DDRA 0, CRA: ORA
+    pia.Write(0, 0x55)
+    if v := d.R16(0x0400); v != 0x5504 || pia.IRQA {
+        t.Errorf("R16($0400) is $%.4X, IRQA %v", v, pia.IRQA)
+    }
+
+    // each byte counts once per access, Heat halves the counts as it goes
+    for i := 0; i < 2; i++ {
+        d.W16(0x0380, 0x1234)
+        d.R16(0x0380)
+    }
+    _, reads, writes := d.Heat(0x037F, 0x0383)
+    for i, want := range []int{0, 1, 1, 0} {
+        if reads[i] != want || writes[i] != want {
+            t.Errorf("heat at $%.4X is %d reads %d writes, want %d", 0x037F+i, reads[i], writes[i], want)
+        }
+    }
+}
@@ -1,5 +1,9 @@
 package mem
 
+import (
+    "fmt"
+)
+
 // it'd be nice to have proper error types, but the use of
 // the R/W methods inlined in expressions like:
 //     mmu.R8(uint16(mmu.R8(m.PC))) 
@@ -16,3 +20,33 @@ type MMU16 interface {
     String() string  //temporary
 }
 
+// an MMU (or device) that wants to know when an access happens, the CPU
+// calls SetCycle with the absolute cycle of each access just before it
+type Clocked interface {
+    SetCycle(cycle uint64)
+}
+
+// A memory-mapped device: PIAs, latches, sound chips, bank registers.  The
+// MMU maps it into a window of the address space and passes it the offset
+// into that window.
+type Device interface {
+    R8(addr uint16) uint8
+    W8(addr uint16, val uint8)
+    Peek8(addr uint16) uint8  // what R8 would return, without its side effects
+    Reset()
+    Tick(cycle uint64)        // the cycle of the access about to happen, like Clocked
+}
+
+// ...so instead an MMU that can't complete an access panics with an
+// AccessError, and the CPU recovers it at the instruction boundary
+type AccessError struct {
+    Addr   uint16
+    Write  bool
+}
+
+func (e AccessError) Error() string {
+    if e.Write {
+        return fmt.Sprintf("invalid write address: $%.4X", e.Addr)
+    }
+    return fmt.Sprintf("invalid read address: $%.4X", e.Addr)
+}
@@ -17,6 +17,13 @@ const FILTER_MAX float32 = 0.08
 const FILTER_LEAK float32 = 0.3
 const LEAK float32 = 0.1
 
+// power-on state: empty shift register, integrators at rest
+func (c *CVSD) Reset() {
+    c.Shift = 0
+    c.Filter = 0
+    c.State = 0
+}
+
 // *not* the actual CVSD algorithm, produces smoother curves
 // may need more careful reconstruction if this ends up too scratchy
 // assume this includes the clock
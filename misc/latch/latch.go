@@ -0,0 +1,42 @@
+package latch
+
+import (
+    "fmt"
+)
+
+// Registers that hold what's written to them and read it back.  Stands in
+// for the output latches, bank selects and chips that aren't emulated yet,
+// so a board that writes to them runs instead of faulting.
+type Latch struct {
+    Regs  []uint8
+}
+
+func NewLatch(size int) *Latch {
+    return &Latch{Regs:make([]uint8, size)}
+}
+
+func (l *Latch) R8(addr uint16) uint8 {
+    return l.Regs[addr]
+}
+
+func (l *Latch) W8(addr uint16, val uint8) {
+    l.Regs[addr] = val
+}
+
+func (l *Latch) Peek8(addr uint16) uint8 {
+    return l.Regs[addr]
+}
+
+// power-on, everything low
+func (l *Latch) Reset() {
+    for i := range l.Regs {
+        l.Regs[i] = 0
+    }
+}
+
+func (l *Latch) Tick(cycle uint64) {
+}
+
+func (l *Latch) String() string {
+    return fmt.Sprintf("latch: % X", l.Regs)
+}
@@ -3,7 +3,6 @@ package m6821
 import (
     "fmt"
 
-    "github.com/bartgrantham/fpemu/ui"
     "github.com/bartgrantham/fpemu/misc/hc55516"
 )
 
@@ -42,6 +41,21 @@ type M6821 struct {
     CA1, CA2, CB1, CB2 bool
     CVSD        hc55516.CVSD
 //    hist []uint8
+
+    // with Timed set, DAC writes and CVSD clocks are queued with the CPU cycle
+    // they happened on and only take effect when Output reaches that cycle
+    Timed       bool
+    cycle       uint64
+    events      []event
+    dac         uint8
+}
+
+// DAC write (port A) or CVSD clock (CB2 rising, data on CA2)
+type event struct {
+    cycle  uint64
+    cvsd   bool
+    val    uint8
+    bit    bool
 }
 
 func (m *M6821) String() string {
@@ -68,7 +82,6 @@ func (m *M6821) R8(addr uint16) uint8 {
             } else {
                 m.CRB &= ^(IRQx2 | IRQx1) // clear interrupt registers
                 m.IRQB = false  // FIX
-ui.Log(fmt.Sprintf("read PIAB: %X %X %X %X %X %X\n", m.ORB, m.INB, m.DDRB, m.ORB & m.DDRB, m.INB & ^m.DDRB, (m.ORB & m.DDRB) | (m.INB & ^m.DDRB)))
                 return (m.ORB & m.DDRB) | (m.INB & ^m.DDRB)  // input + output, appropriately masked
             }
         case 3:
@@ -76,7 +89,23 @@ ui.Log(fmt.Sprintf("read PIAB: %X %X %X %X %X %X\n", m.ORB, m.INB, m.DDRB, m.ORB
         default:
             panic(fmt.Sprintf("Unknown register 0x%.4X", addr))
     }
-    return 0
+}
+
+// R8 without clearing the interrupt flags
+func (m *M6821) Peek8(addr uint16) uint8 {
+    switch addr {
+        case 0:
+            if m.CRA & DDRx == 0 {
+                return m.DDRA
+            }
+            return (m.ORA & m.DDRA) | (m.INA & ^m.DDRA)
+        case 2:
+            if m.CRB & DDRx == 0 {
+                return m.DDRB
+            }
+            return (m.ORB & m.DDRB) | (m.INB & ^m.DDRB)
+    }
+    return m.R8(addr)
 }
 
 func (m *M6821) W8(addr uint16, val uint8) {
@@ -86,6 +115,9 @@ func (m *M6821) W8(addr uint16, val uint8) {
                 m.DDRA = val
             } else {
                 m.ORA = val
+                if m.Timed {
+                    m.events = append(m.events, event{cycle:m.cycle, val:val})
+                }
             }
         case 1:
             m.CRA = val & 0x3F
@@ -108,7 +140,11 @@ func (m *M6821) W8(addr uint16, val uint8) {
                 if m.CRB & Cx2_0 == Cx2_0 {
                     if m.CB2 == false {
                         // positive edge
-                        m.CVSD.Addbit(m.CA2)
+                        if m.Timed {
+                            m.events = append(m.events, event{cycle:m.cycle, cvsd:true, bit:m.CA2})
+                        } else {
+                            m.CVSD.Addbit(m.CA2)
+                        }
                     }
                     m.CB2 = true
                 } else {
@@ -153,10 +189,43 @@ func (m *M6821) IRQ(line uint16) bool {
         default:
             panic(fmt.Sprintf("Unknown IRQ 0x%.4X", line))
     }
-    return false
 }
 
+func (m *M6821) Tick(cycle uint64) {
+    m.cycle = cycle
+}
+
+// Apply the queued events up to and including cycle, returns the DAC value
+// as of then, CVSD.State is also up to date
+// without Timed it's just ORA
+func (m *M6821) Output(cycle uint64) uint8 {
+    if !m.Timed {
+        return m.ORA
+    }
+    i := 0
+    for ; i < len(m.events) && m.events[i].cycle <= cycle; i++ {
+        e := m.events[i]
+        if e.cvsd {
+            m.CVSD.Addbit(e.bit)
+        } else {
+            m.dac = e.val
+        }
+    }
+    m.events = append(m.events[:0], m.events[i:]...)
+    return m.dac
+}
+
+// RESET clears every register, all lines become inputs with interrupts disabled
+// INA/INB and CA1/CB1 are driven from outside so they're left alone
 func (m *M6821) Reset() {
+    m.ORA, m.ORB = 0, 0
+    m.CRA, m.CRB = 0, 0
+    m.DDRA, m.DDRB = 0, 0
+    m.IRQA, m.IRQB = false, false
+    m.CA2, m.CB2 = false, false
+    m.CVSD.Reset()
+    m.events = m.events[:0]
+    m.dac = 0
 }
 
 
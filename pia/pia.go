@@ -1,11 +1,13 @@
 package pia
 
+import (
+    "github.com/bartgrantham/fpemu/mem"
+)
+
 type PIA interface {
-    R8(addr uint16) uint8
-    W8(addr uint16, val uint8)
+    mem.Device
     Read(port uint16) uint8
     Write(port uint16, val uint8)
     IRQ(line uint16) bool
-    Reset()
     String() string  //temporary
 }